@@ -1,36 +1,382 @@
 package config
 
 import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// MaxDescriptionLengthLimit is the largest allowed MAX_DESCRIPTION_LENGTH. The
+// database's CHECK constraint is set to the configured value on startup, so
+// requests that get past the application's check still can't store more.
+const MaxDescriptionLengthLimit = 10000
+
+// defaultJWTSecret is the built-in fallback secret, only acceptable in development
+const defaultJWTSecret = "secret-key"
+
+// minJWTSecretLength is the minimum secret length outside development
+const minJWTSecretLength = 32
+
+// Supported JWT signing algorithms
+const (
+	JWTAlgorithmHS256 = "HS256" // shared secret (JWT_SECRET)
+	JWTAlgorithmRS256 = "RS256" // RSA key pair (JWT_PRIVATE_KEY_FILE, JWT_PUBLIC_KEY_FILE)
 )
 
+// Config holds application settings. Struct tags map config file keys.
 type Config struct {
-	DBHost             string
-	DBPort             string
-	DBUser             string
-	DBPassword         string
-	DBName             string
-	JWTSecret          string
-	JWTExpiryHours     int
-	AutoCompleteMinutes int
-	ServerPort         string
-}
-
-func LoadConfig() *Config {
+	AppEnv                    string  `json:"app_env" yaml:"app_env"`
+	DBHost                    string  `json:"db_host" yaml:"db_host"`
+	DBPort                    string  `json:"db_port" yaml:"db_port"`
+	DBUser                    string  `json:"db_user" yaml:"db_user"`
+	DBPassword                string  `json:"db_password" yaml:"db_password"`
+	DBName                    string  `json:"db_name" yaml:"db_name"`
+	DBConnectAttempts         int     `json:"db_connect_attempts" yaml:"db_connect_attempts"`
+	DBConnectDelaySeconds     int     `json:"db_connect_delay_seconds" yaml:"db_connect_delay_seconds"`
+	JWTAlgorithm              string  `json:"jwt_algorithm" yaml:"jwt_algorithm"`
+	JWTSecret                 string  `json:"jwt_secret" yaml:"jwt_secret"`
+	JWTPrivateKeyFile         string  `json:"jwt_private_key_file" yaml:"jwt_private_key_file"`
+	JWTPublicKeyFile          string  `json:"jwt_public_key_file" yaml:"jwt_public_key_file"`
+	JWTExpiryHours            int     `json:"jwt_expiry_hours" yaml:"jwt_expiry_hours"`
+	JWTIssuer                 string  `json:"jwt_issuer" yaml:"jwt_issuer"`
+	JWTAudience               string  `json:"jwt_audience" yaml:"jwt_audience"`
+	ImpersonationTokenMinutes int     `json:"impersonation_token_minutes" yaml:"impersonation_token_minutes"`
+	TokenRenewalEnabled       bool    `json:"token_renewal_enabled" yaml:"token_renewal_enabled"`
+	AuthCookie                bool    `json:"auth_cookie" yaml:"auth_cookie"`
+	TokenRenewalMinutes       int     `json:"token_renewal_minutes" yaml:"token_renewal_minutes"`
+	BcryptCost                int     `json:"bcrypt_cost" yaml:"bcrypt_cost"`
+	AutoCompleteMinutes       int     `json:"auto_complete_minutes" yaml:"auto_complete_minutes"`
+	WorkerIntervalSeconds     int     `json:"worker_interval_seconds" yaml:"worker_interval_seconds"`
+	WorkerShutdownSeconds     int     `json:"worker_shutdown_seconds" yaml:"worker_shutdown_seconds"`
+	WorkerConcurrency         int     `json:"worker_concurrency" yaml:"worker_concurrency"`
+	PurgeEnabled              bool    `json:"purge_enabled" yaml:"purge_enabled"`
+	PurgeCompletedAfterDays   int     `json:"purge_completed_after_days" yaml:"purge_completed_after_days"`
+	PurgeIntervalHours        int     `json:"purge_interval_hours" yaml:"purge_interval_hours"`
+	ServerPort                string  `json:"server_port" yaml:"server_port"`
+	RateLimitRPS              float64 `json:"rate_limit_rps" yaml:"rate_limit_rps"`
+	RateLimitBurst            int     `json:"rate_limit_burst" yaml:"rate_limit_burst"`
+	AdminEmail                string  `json:"admin_email" yaml:"admin_email"`
+	AdminUsername             string  `json:"admin_username" yaml:"admin_username"`
+	AdminPassword             string  `json:"admin_password" yaml:"admin_password"`
+	IdempotencyKeyTTLHours    int     `json:"idempotency_key_ttl_hours" yaml:"idempotency_key_ttl_hours"`
+	MaxTasksPerUser           int     `json:"max_tasks_per_user" yaml:"max_tasks_per_user"`
+	AutoStartOnEdit           bool    `json:"auto_start_on_edit" yaml:"auto_start_on_edit"`
+	UniqueTaskTitlesPerUser   bool    `json:"unique_task_titles_per_user" yaml:"unique_task_titles_per_user"`
+	MaxDescriptionLength      int     `json:"max_description_length" yaml:"max_description_length"`
+	TaskCreateRatePerMinute   int     `json:"task_create_rate_per_minute" yaml:"task_create_rate_per_minute"`
+	PasswordResetTTLMinutes   int     `json:"password_reset_ttl_minutes" yaml:"password_reset_ttl_minutes"`
+	RequireEmailVerification  bool    `json:"require_email_verification" yaml:"require_email_verification"`
+	EmailVerificationTTLHours int     `json:"email_verification_ttl_hours" yaml:"email_verification_ttl_hours"`
+	MaxRequestBytes           int64   `json:"max_request_bytes" yaml:"max_request_bytes"`
+	LegacyDeleteResponse      bool    `json:"legacy_delete_response" yaml:"legacy_delete_response"`
+	StatsMaxDays              int     `json:"stats_max_days" yaml:"stats_max_days"`
+	DefaultPageSize           int     `json:"default_page_size" yaml:"default_page_size"`
+	MaxPageSize               int     `json:"max_page_size" yaml:"max_page_size"`
+	WebhookURL                string  `json:"webhook_url" yaml:"webhook_url"`
+	WebhookSecret             string  `json:"webhook_secret" yaml:"webhook_secret"`
+	LogLevel                  string  `json:"log_level" yaml:"log_level"`
+	LogTimezone               string  `json:"log_timezone" yaml:"log_timezone"`
+	TLSCertFile               string  `json:"tls_cert_file" yaml:"tls_cert_file"`
+	TLSKeyFile                string  `json:"tls_key_file" yaml:"tls_key_file"`
+
+	// RS256 keys, loaded from the key files by Validate
+	jwtPrivateKey *rsa.PrivateKey
+	jwtPublicKey  *rsa.PublicKey
+}
+
+// LoadConfig builds the configuration. Values are resolved in this order,
+// each overriding the one before it:
+//  1. built-in defaults
+//  2. the YAML or JSON file named by CONFIG_FILE, if set
+//  3. environment variables
+func LoadConfig() (*Config, error) {
+	cfg := defaultConfig()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return nil, fmt.Errorf("loading config file %s: %w", path, err)
+		}
+	}
+
+	applyEnv(cfg)
+	return cfg, nil
+}
+
+// defaultConfig returns the built-in defaults
+func defaultConfig() *Config {
 	return &Config{
-		DBHost:             getEnv("DB_HOST", "localhost"),
-		DBPort:             getEnv("DB_PORT", "5432"),
-		DBUser:             getEnv("DB_USER", "postgres"),
-		DBPassword:         getEnv("DB_PASSWORD", "postgres"),
-		DBName:             getEnv("DB_NAME", "taskdb"),
-		JWTSecret:          getEnv("JWT_SECRET", "secret-key"),
-		JWTExpiryHours:     getEnvInt("JWT_EXPIRY_HOURS", 24),
-		AutoCompleteMinutes: getEnvInt("AUTO_COMPLETE_MINUTES", 30),
-		ServerPort:         getEnv("SERVER_PORT", "8081"),
+		AppEnv:                    "production",
+		DBHost:                    "localhost",
+		DBPort:                    "5432",
+		DBUser:                    "postgres",
+		DBPassword:                "postgres",
+		DBName:                    "taskdb",
+		DBConnectAttempts:         5,
+		DBConnectDelaySeconds:     1,
+		JWTAlgorithm:              JWTAlgorithmHS256,
+		JWTSecret:                 defaultJWTSecret,
+		JWTExpiryHours:            24,
+		TokenRenewalMinutes:       60,
+		ImpersonationTokenMinutes: 15,
+		BcryptCost:                bcrypt.DefaultCost,
+		AutoCompleteMinutes:       30,
+		WorkerIntervalSeconds:     60,
+		WorkerShutdownSeconds:     10,
+		WorkerConcurrency:         1,
+		PurgeCompletedAfterDays:   90,
+		PurgeIntervalHours:        24,
+		ServerPort:                "8081",
+		RateLimitRPS:              1,
+		RateLimitBurst:            5,
+		AdminUsername:             "admin",
+		IdempotencyKeyTTLHours:    24,
+		AutoStartOnEdit:           true,
+		MaxDescriptionLength:      MaxDescriptionLengthLimit,
+		PasswordResetTTLMinutes:   60,
+		EmailVerificationTTLHours: 48,
+		MaxRequestBytes:           1 << 20,
+		StatsMaxDays:              366,
+		DefaultPageSize:           20,
+		MaxPageSize:               100,
+		LogLevel:                  "info",
+		LogTimezone:               "UTC",
+	}
+}
+
+// loadFile overlays values from a YAML (.yaml/.yml) or JSON (.json) file.
+// Keys missing from the file keep their current values.
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return json.Unmarshal(data, cfg)
+	case ".yaml", ".yml":
+		return yaml.Unmarshal(data, cfg)
+	default:
+		return errors.New("unsupported config file extension (use .yaml, .yml or .json)")
 	}
 }
 
+// applyEnv overlays values from environment variables that are set
+func applyEnv(cfg *Config) {
+	cfg.AppEnv = getEnv("APP_ENV", cfg.AppEnv)
+	cfg.DBHost = getEnv("DB_HOST", cfg.DBHost)
+	cfg.DBPort = getEnv("DB_PORT", cfg.DBPort)
+	cfg.DBUser = getEnv("DB_USER", cfg.DBUser)
+	cfg.DBPassword = getEnv("DB_PASSWORD", cfg.DBPassword)
+	cfg.DBName = getEnv("DB_NAME", cfg.DBName)
+	cfg.DBConnectAttempts = getEnvInt("DB_CONNECT_ATTEMPTS", cfg.DBConnectAttempts)
+	cfg.DBConnectDelaySeconds = getEnvInt("DB_CONNECT_DELAY_SECONDS", cfg.DBConnectDelaySeconds)
+	cfg.JWTAlgorithm = getEnv("JWT_ALGORITHM", cfg.JWTAlgorithm)
+	cfg.JWTSecret = getEnv("JWT_SECRET", cfg.JWTSecret)
+	cfg.JWTPrivateKeyFile = getEnv("JWT_PRIVATE_KEY_FILE", cfg.JWTPrivateKeyFile)
+	cfg.JWTPublicKeyFile = getEnv("JWT_PUBLIC_KEY_FILE", cfg.JWTPublicKeyFile)
+	cfg.JWTExpiryHours = getEnvInt("JWT_EXPIRY_HOURS", cfg.JWTExpiryHours)
+	cfg.JWTIssuer = getEnv("JWT_ISSUER", cfg.JWTIssuer)
+	cfg.JWTAudience = getEnv("JWT_AUDIENCE", cfg.JWTAudience)
+	cfg.ImpersonationTokenMinutes = getEnvInt("IMPERSONATION_TOKEN_MINUTES", cfg.ImpersonationTokenMinutes)
+	cfg.TokenRenewalEnabled = getEnvBool("TOKEN_RENEWAL_ENABLED", cfg.TokenRenewalEnabled)
+	cfg.TokenRenewalMinutes = getEnvInt("TOKEN_RENEWAL_MINUTES", cfg.TokenRenewalMinutes)
+	cfg.AuthCookie = getEnvBool("AUTH_COOKIE", cfg.AuthCookie)
+	cfg.BcryptCost = getEnvInt("BCRYPT_COST", cfg.BcryptCost)
+	cfg.AutoCompleteMinutes = getEnvInt("AUTO_COMPLETE_MINUTES", cfg.AutoCompleteMinutes)
+	cfg.WorkerIntervalSeconds = getEnvInt("WORKER_INTERVAL_SECONDS", cfg.WorkerIntervalSeconds)
+	cfg.WorkerShutdownSeconds = getEnvInt("WORKER_SHUTDOWN_SECONDS", cfg.WorkerShutdownSeconds)
+	cfg.WorkerConcurrency = getEnvInt("WORKER_CONCURRENCY", cfg.WorkerConcurrency)
+	cfg.PurgeEnabled = getEnvBool("PURGE_ENABLED", cfg.PurgeEnabled)
+	cfg.PurgeCompletedAfterDays = getEnvInt("PURGE_COMPLETED_AFTER_DAYS", cfg.PurgeCompletedAfterDays)
+	cfg.PurgeIntervalHours = getEnvInt("PURGE_INTERVAL_HOURS", cfg.PurgeIntervalHours)
+	cfg.ServerPort = getEnv("SERVER_PORT", cfg.ServerPort)
+	cfg.RateLimitRPS = getEnvFloat("RATE_LIMIT_RPS", cfg.RateLimitRPS)
+	cfg.RateLimitBurst = getEnvInt("RATE_LIMIT_BURST", cfg.RateLimitBurst)
+	cfg.AdminEmail = getEnv("ADMIN_EMAIL", cfg.AdminEmail)
+	cfg.AdminUsername = getEnv("ADMIN_USERNAME", cfg.AdminUsername)
+	cfg.AdminPassword = getEnv("ADMIN_PASSWORD", cfg.AdminPassword)
+	cfg.IdempotencyKeyTTLHours = getEnvInt("IDEMPOTENCY_KEY_TTL_HOURS", cfg.IdempotencyKeyTTLHours)
+	cfg.MaxTasksPerUser = getEnvInt("MAX_TASKS_PER_USER", cfg.MaxTasksPerUser)
+	cfg.AutoStartOnEdit = getEnvBool("AUTO_START_ON_EDIT", cfg.AutoStartOnEdit)
+	cfg.UniqueTaskTitlesPerUser = getEnvBool("UNIQUE_TASK_TITLES_PER_USER", cfg.UniqueTaskTitlesPerUser)
+	cfg.MaxDescriptionLength = getEnvInt("MAX_DESCRIPTION_LENGTH", cfg.MaxDescriptionLength)
+	cfg.TaskCreateRatePerMinute = getEnvInt("TASK_CREATE_RATE_PER_MINUTE", cfg.TaskCreateRatePerMinute)
+	cfg.PasswordResetTTLMinutes = getEnvInt("PASSWORD_RESET_TTL_MINUTES", cfg.PasswordResetTTLMinutes)
+	cfg.RequireEmailVerification = getEnvBool("REQUIRE_EMAIL_VERIFICATION", cfg.RequireEmailVerification)
+	cfg.EmailVerificationTTLHours = getEnvInt("EMAIL_VERIFICATION_TTL_HOURS", cfg.EmailVerificationTTLHours)
+	cfg.MaxRequestBytes = int64(getEnvInt("MAX_REQUEST_BYTES", int(cfg.MaxRequestBytes)))
+	cfg.LegacyDeleteResponse = getEnvBool("LEGACY_DELETE_RESPONSE", cfg.LegacyDeleteResponse)
+	cfg.StatsMaxDays = getEnvInt("STATS_MAX_DAYS", cfg.StatsMaxDays)
+	cfg.DefaultPageSize = getEnvInt("DEFAULT_PAGE_SIZE", cfg.DefaultPageSize)
+	cfg.MaxPageSize = getEnvInt("MAX_PAGE_SIZE", cfg.MaxPageSize)
+	cfg.WebhookURL = getEnv("WEBHOOK_URL", cfg.WebhookURL)
+	cfg.WebhookSecret = getEnv("WEBHOOK_SECRET", cfg.WebhookSecret)
+	cfg.LogLevel = getEnv("LOG_LEVEL", cfg.LogLevel)
+	cfg.LogTimezone = getEnv("LOG_TIMEZONE", cfg.LogTimezone)
+	cfg.TLSCertFile = getEnv("TLS_CERT_FILE", cfg.TLSCertFile)
+	cfg.TLSKeyFile = getEnv("TLS_KEY_FILE", cfg.TLSKeyFile)
+}
+
+// IsDevelopment reports whether the app runs in a development environment,
+// where the weak default JWT secret is tolerated
+func (c *Config) IsDevelopment() bool {
+	return c.AppEnv == "development" || c.AppEnv == "dev"
+}
+
+// TLSEnabled reports whether the server should serve HTTPS directly
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// JWTPrivateKey returns the RS256 signing key, or nil if it isn't loaded
+func (c *Config) JWTPrivateKey() *rsa.PrivateKey {
+	return c.jwtPrivateKey
+}
+
+// JWTPublicKey returns the RS256 verification key, or nil if it isn't loaded
+func (c *Config) JWTPublicKey() *rsa.PublicKey {
+	return c.jwtPublicKey
+}
+
+// loadJWTKeys reads the RS256 key pair. Without JWT_PUBLIC_KEY_FILE the
+// public half of the private key is used.
+func (c *Config) loadJWTKeys() error {
+	if c.JWTPrivateKeyFile == "" {
+		return errors.New("JWT_PRIVATE_KEY_FILE must be set when JWT_ALGORITHM is RS256")
+	}
+	data, err := os.ReadFile(c.JWTPrivateKeyFile)
+	if err != nil {
+		return fmt.Errorf("reading JWT_PRIVATE_KEY_FILE: %w", err)
+	}
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+	if err != nil {
+		return fmt.Errorf("parsing JWT_PRIVATE_KEY_FILE: %w", err)
+	}
+
+	publicKey := &privateKey.PublicKey
+	if c.JWTPublicKeyFile != "" {
+		data, err := os.ReadFile(c.JWTPublicKeyFile)
+		if err != nil {
+			return fmt.Errorf("reading JWT_PUBLIC_KEY_FILE: %w", err)
+		}
+		if publicKey, err = jwt.ParseRSAPublicKeyFromPEM(data); err != nil {
+			return fmt.Errorf("parsing JWT_PUBLIC_KEY_FILE: %w", err)
+		}
+	}
+
+	c.jwtPrivateKey = privateKey
+	c.jwtPublicKey = publicKey
+	return nil
+}
+
+// Validate checks the configuration and returns every problem found. With
+// JWT_ALGORITHM=RS256 it also loads the key files.
+func (c *Config) Validate() error {
+	var errs []error
+
+	switch c.JWTAlgorithm {
+	case JWTAlgorithmHS256:
+		if c.JWTSecret == "" {
+			errs = append(errs, errors.New("JWT_SECRET must be set"))
+		} else if !c.IsDevelopment() {
+			if c.JWTSecret == defaultJWTSecret {
+				errs = append(errs, errors.New("JWT_SECRET must not be the default value outside development"))
+			} else if len(c.JWTSecret) < minJWTSecretLength {
+				errs = append(errs, fmt.Errorf("JWT_SECRET must be at least %d characters outside development", minJWTSecretLength))
+			}
+		}
+	case JWTAlgorithmRS256:
+		if err := c.loadJWTKeys(); err != nil {
+			errs = append(errs, err)
+		}
+	default:
+		errs = append(errs, fmt.Errorf("JWT_ALGORITHM must be %s or %s", JWTAlgorithmHS256, JWTAlgorithmRS256))
+	}
+
+	required := map[string]string{
+		"DB_HOST":     c.DBHost,
+		"DB_PORT":     c.DBPort,
+		"DB_USER":     c.DBUser,
+		"DB_NAME":     c.DBName,
+		"SERVER_PORT": c.ServerPort,
+	}
+	for _, key := range []string{"DB_HOST", "DB_PORT", "DB_USER", "DB_NAME", "SERVER_PORT"} {
+		if required[key] == "" {
+			errs = append(errs, fmt.Errorf("%s must be set", key))
+		}
+	}
+
+	positive := map[string]int{
+		"JWT_EXPIRY_HOURS":             c.JWTExpiryHours,
+		"IMPERSONATION_TOKEN_MINUTES":  c.ImpersonationTokenMinutes,
+		"AUTO_COMPLETE_MINUTES":        c.AutoCompleteMinutes,
+		"WORKER_INTERVAL_SECONDS":      c.WorkerIntervalSeconds,
+		"WORKER_SHUTDOWN_SECONDS":      c.WorkerShutdownSeconds,
+		"WORKER_CONCURRENCY":           c.WorkerConcurrency,
+		"PURGE_COMPLETED_AFTER_DAYS":   c.PurgeCompletedAfterDays,
+		"PURGE_INTERVAL_HOURS":         c.PurgeIntervalHours,
+		"RATE_LIMIT_BURST":             c.RateLimitBurst,
+		"DB_CONNECT_ATTEMPTS":          c.DBConnectAttempts,
+		"DB_CONNECT_DELAY_SECONDS":     c.DBConnectDelaySeconds,
+		"IDEMPOTENCY_KEY_TTL_HOURS":    c.IdempotencyKeyTTLHours,
+		"PASSWORD_RESET_TTL_MINUTES":   c.PasswordResetTTLMinutes,
+		"EMAIL_VERIFICATION_TTL_HOURS": c.EmailVerificationTTLHours,
+		"DEFAULT_PAGE_SIZE":            c.DefaultPageSize,
+		"MAX_PAGE_SIZE":                c.MaxPageSize,
+		"STATS_MAX_DAYS":               c.StatsMaxDays,
+	}
+	for _, key := range []string{"JWT_EXPIRY_HOURS", "IMPERSONATION_TOKEN_MINUTES", "AUTO_COMPLETE_MINUTES", "WORKER_INTERVAL_SECONDS", "WORKER_SHUTDOWN_SECONDS", "WORKER_CONCURRENCY", "PURGE_COMPLETED_AFTER_DAYS", "PURGE_INTERVAL_HOURS", "RATE_LIMIT_BURST", "DB_CONNECT_ATTEMPTS", "DB_CONNECT_DELAY_SECONDS", "IDEMPOTENCY_KEY_TTL_HOURS", "PASSWORD_RESET_TTL_MINUTES", "EMAIL_VERIFICATION_TTL_HOURS", "DEFAULT_PAGE_SIZE", "MAX_PAGE_SIZE", "STATS_MAX_DAYS"} {
+		if positive[key] <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be greater than zero", key))
+		}
+	}
+	if c.DefaultPageSize > c.MaxPageSize {
+		errs = append(errs, errors.New("DEFAULT_PAGE_SIZE must not exceed MAX_PAGE_SIZE"))
+	}
+	if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+		errs = append(errs, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost))
+	}
+	if c.MaxTasksPerUser < 0 {
+		errs = append(errs, errors.New("MAX_TASKS_PER_USER must not be negative"))
+	}
+	if c.MaxDescriptionLength <= 0 || c.MaxDescriptionLength > MaxDescriptionLengthLimit {
+		errs = append(errs, fmt.Errorf("MAX_DESCRIPTION_LENGTH must be between 1 and %d", MaxDescriptionLengthLimit))
+	}
+	if c.TaskCreateRatePerMinute < 0 {
+		errs = append(errs, errors.New("TASK_CREATE_RATE_PER_MINUTE must not be negative"))
+	}
+	if c.TokenRenewalEnabled && c.TokenRenewalMinutes <= 0 {
+		errs = append(errs, errors.New("TOKEN_RENEWAL_MINUTES must be greater than zero when TOKEN_RENEWAL_ENABLED is set"))
+	}
+	if c.MaxRequestBytes <= 0 {
+		errs = append(errs, errors.New("MAX_REQUEST_BYTES must be greater than zero"))
+	}
+	if c.RateLimitRPS <= 0 {
+		errs = append(errs, errors.New("RATE_LIMIT_RPS must be greater than zero"))
+	}
+	if _, err := time.LoadLocation(c.LogTimezone); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_TIMEZONE must be an IANA time zone name: %w", err))
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must both be set to enable HTTPS"))
+	}
+
+	return errors.Join(errs...)
+}
+
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -39,11 +385,47 @@ func getEnv(key, defaultValue string) string {
 	return value
 }
 
+// getEnvInt reads an integer env var, keeping the default (with a warning)
+// when the value is set but not a valid integer
 func getEnvInt(key string, defaultValue int) int {
 	value := os.Getenv(key)
 	if value == "" {
 		return defaultValue
 	}
-	intVal, _ := strconv.Atoi(value)
+	intVal, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("Invalid integer in environment variable, using default", "key", key, "value", value, "default", defaultValue)
+		return defaultValue
+	}
 	return intVal
 }
+
+// getEnvFloat reads a float env var, keeping the default (with a warning)
+// when the value is set but not a valid number
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	floatVal, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		slog.Warn("Invalid number in environment variable, using default", "key", key, "value", value, "default", defaultValue)
+		return defaultValue
+	}
+	return floatVal
+}
+
+// getEnvBool reads a boolean env var (true/false, 1/0), keeping the default
+// (with a warning) when the value is set but not a valid boolean
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	boolVal, err := strconv.ParseBool(value)
+	if err != nil {
+		slog.Warn("Invalid boolean in environment variable, using default", "key", key, "value", value, "default", defaultValue)
+		return defaultValue
+	}
+	return boolVal
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+// validConfig returns the defaults with a development environment, which
+// Validate accepts
+func validConfig(t *testing.T) *Config {
+	t.Helper()
+	cfg := defaultConfig()
+	cfg.AppEnv = "development"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("default development config is invalid: %v", err)
+	}
+	return cfg
+}
+
+func TestBcryptCost(t *testing.T) {
+	t.Run("defaults to bcrypt.DefaultCost", func(t *testing.T) {
+		t.Setenv("BCRYPT_COST", "")
+		cfg, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("LoadConfig: %v", err)
+		}
+		if cfg.BcryptCost != bcrypt.DefaultCost {
+			t.Errorf("BcryptCost = %d, want %d", cfg.BcryptCost, bcrypt.DefaultCost)
+		}
+	})
+
+	t.Run("read from BCRYPT_COST", func(t *testing.T) {
+		t.Setenv("BCRYPT_COST", "12")
+		cfg, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("LoadConfig: %v", err)
+		}
+		if cfg.BcryptCost != 12 {
+			t.Errorf("BcryptCost = %d, want 12", cfg.BcryptCost)
+		}
+	})
+
+	for _, cost := range []int{bcrypt.MinCost, bcrypt.MaxCost} {
+		cfg := validConfig(t)
+		cfg.BcryptCost = cost
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("BcryptCost %d: unexpected error %v", cost, err)
+		}
+	}
+	for _, cost := range []int{bcrypt.MinCost - 1, bcrypt.MaxCost + 1} {
+		cfg := validConfig(t)
+		cfg.BcryptCost = cost
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "BCRYPT_COST") {
+			t.Errorf("BcryptCost %d: err = %v, want a BCRYPT_COST error", cost, err)
+		}
+	}
+}
@@ -1,21 +1,43 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
-	_ "github.com/lib/pq"
+	"io"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
 	"taskapi/config"
 )
 
+// Querier is implemented by both *sql.DB and *sql.Tx, so repository
+// functions can run either directly or inside a transaction
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
 // DB holds the database connection
 type DB struct {
-	Conn *sql.DB
+	Conn     *sql.DB
+	migrated atomic.Bool
 }
 
 // NewDB creates a new database connection
 func NewDB(cfg *config.Config) (*DB, error) {
 	connStr := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable timezone=UTC",
 		cfg.DBHost,
 		cfg.DBPort,
 		cfg.DBUser,
@@ -28,47 +50,402 @@ func NewDB(cfg *config.Config) (*DB, error) {
 		return nil, err
 	}
 
-	// Test the connection
-	if err := conn.Ping(); err != nil {
-		return nil, err
+	// Test the connection, retrying with backoff while the database starts up
+	attempts := cfg.DBConnectAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := time.Duration(cfg.DBConnectDelaySeconds) * time.Second
+
+	for attempt := 1; ; attempt++ {
+		err = conn.Ping()
+		if err == nil {
+			break
+		}
+
+		slog.Warn("Database not reachable", "attempt", attempt, "max_attempts", attempts, "error", err)
+		if attempt >= attempts {
+			conn.Close()
+			return nil, fmt.Errorf("database unreachable after %d attempts: %w", attempts, err)
+		}
+
+		time.Sleep(delay)
+		delay *= 2
 	}
 
 	return &DB{Conn: conn}, nil
 }
 
-// RunMigrations creates the necessary database tables
+// migrationLockID is the advisory lock key held while applying a migration
+const migrationLockID = 7243001
+
+// RunMigrations applies every migration that hasn't been applied yet, in
+// version order. Each migration runs in its own transaction together with
+// its schema_migrations record, so a failure leaves no partial migration.
 func (db *DB) RunMigrations() error {
-	migrations := []string{
-		`CREATE TABLE IF NOT EXISTS users (
-			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-			email VARCHAR(255) UNIQUE NOT NULL,
-			username VARCHAR(255) UNIQUE NOT NULL,
-			password VARCHAR(255) NOT NULL,
-			role VARCHAR(50) DEFAULT 'user',
-			created_at TIMESTAMP DEFAULT NOW()
-		);`,
-		`CREATE TABLE IF NOT EXISTS tasks (
-			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-			title VARCHAR(255) NOT NULL,
-			description TEXT,
-			status VARCHAR(50) DEFAULT 'pending',
-			created_at TIMESTAMP DEFAULT NOW(),
-			updated_at TIMESTAMP DEFAULT NOW()
-		);`,
-		`CREATE INDEX IF NOT EXISTS idx_tasks_user_id ON tasks(user_id);`,
-		`CREATE INDEX IF NOT EXISTS idx_tasks_status ON tasks(status);`,
+	ctx := context.Background()
+
+	if _, err := db.Conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP DEFAULT NOW()
+	);`); err != nil {
+		return err
+	}
+
+	applied, err := db.appliedMigrations(ctx)
+	if err != nil {
+		return err
 	}
 
 	for _, migration := range migrations {
-		if _, err := db.Conn.Exec(migration); err != nil {
+		if applied[migration.Version] {
+			continue
+		}
+
+		err := db.WithTx(ctx, func(tx *sql.Tx) error {
+			// Serialize with other instances migrating at the same time
+			if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+				return err
+			}
+
+			var done bool
+			row := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, migration.Version)
+			if err := row.Scan(&done); err != nil || done {
+				return err
+			}
+
+			if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name)
 			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Name, err)
 		}
 	}
 
+	db.migrated.Store(true)
 	return nil
 }
 
+// RollbackMigration reverts the most recently applied migration and removes
+// its schema_migrations record in one transaction. It returns the version
+// that was rolled back, or 0 if nothing was applied.
+func (db *DB) RollbackMigration() (int, error) {
+	ctx := context.Background()
+	var rolledBack int
+
+	err := db.WithTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+			return err
+		}
+
+		var version sql.NullInt64
+		if err := tx.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+			return err
+		}
+		if !version.Valid {
+			return nil
+		}
+
+		migration, ok := findMigration(int(version.Int64))
+		if !ok {
+			return fmt.Errorf("applied migration %d is not known to this build", version.Int64)
+		}
+
+		if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+			return fmt.Errorf("migration %d (%s) down: %w", migration.Version, migration.Name, err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version); err != nil {
+			return err
+		}
+
+		rolledBack = migration.Version
+		return nil
+	})
+
+	return rolledBack, err
+}
+
+// findMigration looks up a migration by version
+func findMigration(version int) (Migration, bool) {
+	for _, migration := range migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+// appliedMigrations returns the set of migration versions already applied
+func (db *DB) appliedMigrations(ctx context.Context) (map[int]bool, error) {
+	rows, err := db.Conn.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+// AppliedMigration is a migration recorded in schema_migrations
+type AppliedMigration struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// MigrationStatus compares the migrations recorded in schema_migrations with
+// those known to this build
+type MigrationStatus struct {
+	Applied       []AppliedMigration `json:"applied"`
+	Pending       int                `json:"pending"`
+	LatestVersion int                `json:"latest_version"`
+}
+
+// MigrationStatus lists the applied migrations, oldest first, and counts the
+// migrations known to this build that haven't been applied
+func (db *DB) MigrationStatus(ctx context.Context) (*MigrationStatus, error) {
+	rows, err := db.Conn.QueryContext(ctx, `SELECT version, name, applied_at FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	status := &MigrationStatus{Applied: []AppliedMigration{}}
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var m AppliedMigration
+		if err := rows.Scan(&m.Version, &m.Name, &m.AppliedAt); err != nil {
+			return nil, err
+		}
+		status.Applied = append(status.Applied, m)
+		applied[m.Version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, migration := range migrations {
+		if !applied[migration.Version] {
+			status.Pending++
+		}
+		if migration.Version > status.LatestVersion {
+			status.LatestVersion = migration.Version
+		}
+	}
+
+	return status, nil
+}
+
+// MigrationsApplied reports whether RunMigrations has completed successfully
+func (db *DB) MigrationsApplied() bool {
+	return db.migrated.Load()
+}
+
+// Ping checks that the database is reachable
+func (db *DB) Ping(ctx context.Context) error {
+	return db.Conn.PingContext(ctx)
+}
+
+// SeedAdmin creates the initial admin user from config when no admin exists.
+// It does nothing if ADMIN_EMAIL or ADMIN_PASSWORD is unset.
+func (db *DB) SeedAdmin(cfg *config.Config) (bool, error) {
+	if cfg.AdminEmail == "" || cfg.AdminPassword == "" {
+		return false, nil
+	}
+
+	var exists bool
+	if err := db.Conn.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE role = 'admin')`).Scan(&exists); err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(cfg.AdminPassword), cfg.BcryptCost)
+	if err != nil {
+		return false, err
+	}
+
+	// ON CONFLICT keeps restarts idempotent if the email or username is taken.
+	// The configured admin email is trusted, so it starts out verified.
+	query := `
+		INSERT INTO users (email, username, password, role, email_verified)
+		VALUES ($1, $2, $3, 'admin', TRUE)
+		ON CONFLICT DO NOTHING
+	`
+	result, err := db.Conn.Exec(query, cfg.AdminEmail, cfg.AdminUsername, string(hashedPassword))
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// UniqueTaskTitlesIndex enforces UNIQUE_TASK_TITLES_PER_USER. It only covers
+// open tasks, so a recurring task's next occurrence can reuse the title of
+// the completed one.
+const UniqueTaskTitlesIndex = "idx_tasks_user_title_unique"
+
+// SyncUniqueTaskTitles creates the unique index on each user's open task
+// titles (compared case-insensitively) when enabled and drops it otherwise.
+// The index follows the config rather than a migration so the setting can be
+// switched in either direction; creating it fails if titles already clash.
+func (db *DB) SyncUniqueTaskTitles(enabled bool) error {
+	if !enabled {
+		_, err := db.Conn.Exec(`DROP INDEX IF EXISTS ` + UniqueTaskTitlesIndex)
+		return err
+	}
+
+	query := `
+		CREATE UNIQUE INDEX IF NOT EXISTS ` + UniqueTaskTitlesIndex + `
+		ON tasks (user_id, lower(title))
+		WHERE deleted_at IS NULL AND status NOT IN ('completed', 'cancelled')
+	`
+	_, err := db.Conn.Exec(query)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return fmt.Errorf("existing open tasks share a title, rename them before enabling unique titles: %w", err)
+	}
+	return err
+}
+
+// DescriptionLengthConstraint is the CHECK constraint on task descriptions,
+// first added by migration 18
+const DescriptionLengthConstraint = "tasks_description_length"
+
+// SyncDescriptionLength sets the CHECK constraint on task descriptions to
+// MAX_DESCRIPTION_LENGTH, so writes that bypass the application are held to
+// the same limit. Like the migration it is NOT VALID: descriptions stored
+// under a higher earlier limit are kept, but new writes are checked.
+func (db *DB) SyncDescriptionLength(limit int) error {
+	query := fmt.Sprintf(`
+		ALTER TABLE tasks
+		DROP CONSTRAINT IF EXISTS %[1]s,
+		ADD CONSTRAINT %[1]s CHECK (char_length(description) <= %[2]d) NOT VALID
+	`, DescriptionLengthConstraint, limit)
+	_, err := db.Conn.Exec(query)
+	return err
+}
+
+// Retry settings for transactions that hit a serialization failure or deadlock
+const (
+	txMaxAttempts    = 3
+	txInitialBackoff = 20 * time.Millisecond
+)
+
+// PostgreSQL error codes that mean a transaction lost a race and may
+// succeed if run again
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+// IsRetryable reports whether err is a serialization failure or deadlock
+func IsRetryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == serializationFailure || pqErr.Code == deadlockDetected
+}
+
+// IsConnectionError reports whether err means the database could not be
+// reached or the connection was lost, as opposed to a problem with the
+// query itself. Such errors are worth retrying once the database is back.
+func IsConnectionError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// Class 08 is connection_exception; 57P01-57P03 mean the server is
+		// shutting down or not accepting connections yet
+		switch pqErr.Code {
+		case "57P01", "57P02", "57P03":
+			return true
+		}
+		return pqErr.Code.Class() == "08"
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// WithRetryTx runs fn inside a transaction like WithTx, running the whole
+// transaction again when it fails with a serialization failure or deadlock,
+// up to txMaxAttempts times with exponential backoff. fn must be safe to run
+// more than once. Any other error is returned immediately.
+func (db *DB) WithRetryTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return retry(ctx, txMaxAttempts, txInitialBackoff, func() error {
+		return db.WithTx(ctx, fn)
+	})
+}
+
+// retry calls run until it succeeds, fails with an error IsRetryable
+// rejects, or has been called attempts times. It stops early if ctx ends
+// while waiting, returning the last error.
+func retry(ctx context.Context, attempts int, backoff time.Duration, run func() error) error {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = run()
+		if err == nil || !IsRetryable(err) || attempt == attempts {
+			return err
+		}
+
+		slog.WarnContext(ctx, "Retrying transaction", "attempt", attempt, "max_attempts", attempts, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return err
+}
+
+// WithTx runs fn inside a transaction, committing if it returns nil and
+// rolling back on any error or panic
+func (db *DB) WithTx(ctx context.Context, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := db.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 // Close closes the database connection
 func (db *DB) Close() error {
 	return db.Conn.Close()
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestRetry(t *testing.T) {
+	serialization := &pq.Error{Code: serializationFailure}
+	deadlock := &pq.Error{Code: deadlockDetected}
+	uniqueViolation := &pq.Error{Code: "23505"}
+
+	tests := []struct {
+		name      string
+		errs      []error // returned by successive calls; nil once exhausted
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "succeeds first time", wantCalls: 1},
+		{name: "serialization failure then success", errs: []error{serialization}, wantCalls: 2},
+		{name: "wrapped deadlock then success", errs: []error{fmt.Errorf("updating task: %w", deadlock)}, wantCalls: 2},
+		{name: "gives up after the last attempt", errs: []error{serialization, serialization, serialization}, wantCalls: 3, wantErr: serialization},
+		{name: "other errors are not retried", errs: []error{uniqueViolation}, wantCalls: 1, wantErr: uniqueViolation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := retry(context.Background(), 3, time.Millisecond, func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryStopsWhenContextEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	err := retry(ctx, 3, time.Hour, func() error {
+		calls++
+		return &pq.Error{Code: serializationFailure}
+	})
+
+	if !IsRetryable(err) {
+		t.Errorf("err = %v, want the serialization failure", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
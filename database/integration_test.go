@@ -0,0 +1,103 @@
+package database_test
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"taskapi/database"
+	"taskapi/internal/testdb"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(testdb.Main(m))
+}
+
+func TestRunMigrationsIsIdempotent(t *testing.T) {
+	db := testdb.New(t)
+	ctx := context.Background()
+
+	// testdb.Main has already applied every migration once
+	before, err := db.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	if before.Pending != 0 {
+		t.Fatalf("%d migrations pending after the first run", before.Pending)
+	}
+
+	if err := db.RunMigrations(); err != nil {
+		t.Fatalf("second RunMigrations: %v", err)
+	}
+
+	after, err := db.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	if after.Pending != 0 {
+		t.Errorf("%d migrations pending after the second run", after.Pending)
+	}
+	if len(after.Applied) != len(before.Applied) {
+		t.Fatalf("applied %d migrations, want %d", len(after.Applied), len(before.Applied))
+	}
+	for i, m := range after.Applied {
+		was := before.Applied[i]
+		if m.Version != was.Version || m.Name != was.Name || !m.AppliedAt.Equal(was.AppliedAt) {
+			t.Errorf("migration %d was reapplied: %+v, was %+v", m.Version, m, was)
+		}
+	}
+	if last := after.Applied[len(after.Applied)-1].Version; last != after.LatestVersion {
+		t.Errorf("latest applied version = %d, want %d", last, after.LatestVersion)
+	}
+}
+
+// TestRunMigrationsConcurrently starts two instances against the same
+// database at once; the advisory lock must keep them from applying a
+// migration twice
+func TestRunMigrationsConcurrently(t *testing.T) {
+	db := testdb.New(t)
+	ctx := context.Background()
+
+	version, err := db.RollbackMigration()
+	if err != nil {
+		t.Fatalf("RollbackMigration: %v", err)
+	}
+	if version == 0 {
+		t.Fatal("no migration to roll back")
+	}
+
+	other, err := database.NewDB(testdb.Config(t))
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	defer other.Close()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, instance := range []*database.DB{db, other} {
+		wg.Add(1)
+		go func(i int, instance *database.DB) {
+			defer wg.Done()
+			errs[i] = instance.RunMigrations()
+		}(i, instance)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("instance %d: RunMigrations: %v", i, err)
+		}
+	}
+
+	status, err := db.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	if status.Pending != 0 {
+		t.Errorf("%d migrations pending", status.Pending)
+	}
+	if status.LatestVersion != version {
+		t.Errorf("latest version = %d, want %d", status.LatestVersion, version)
+	}
+}
@@ -0,0 +1,241 @@
+package database
+
+// Migration is a single numbered schema change with SQL to apply (Up) and
+// revert (Down) it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// migrations is the ordered list of schema changes. Append new migrations
+// with the next version number; never edit or reorder applied ones. The
+// early statements keep IF NOT EXISTS so databases created before migration
+// tracking existed are adopted cleanly.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_users",
+		Up: `CREATE TABLE IF NOT EXISTS users (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			email VARCHAR(255) UNIQUE NOT NULL,
+			username VARCHAR(255) UNIQUE NOT NULL,
+			password VARCHAR(255) NOT NULL,
+			role VARCHAR(50) DEFAULT 'user',
+			created_at TIMESTAMP DEFAULT NOW()
+		);`,
+		Down: `DROP TABLE IF EXISTS users;`,
+	},
+	{
+		Version: 2,
+		Name:    "create_tasks",
+		Up: `CREATE TABLE IF NOT EXISTS tasks (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			title VARCHAR(255) NOT NULL,
+			description TEXT,
+			status VARCHAR(50) DEFAULT 'pending',
+			created_at TIMESTAMP DEFAULT NOW(),
+			updated_at TIMESTAMP DEFAULT NOW()
+		);`,
+		Down: `DROP TABLE IF EXISTS tasks;`,
+	},
+	{
+		Version: 3,
+		Name:    "create_tasks_indexes",
+		Up: `CREATE INDEX IF NOT EXISTS idx_tasks_user_id ON tasks(user_id);
+			CREATE INDEX IF NOT EXISTS idx_tasks_status ON tasks(status);`,
+		Down: `DROP INDEX IF EXISTS idx_tasks_status;
+			DROP INDEX IF EXISTS idx_tasks_user_id;`,
+	},
+	{
+		Version: 4,
+		Name:    "add_tasks_deleted_at",
+		Up:      `ALTER TABLE tasks ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;`,
+		Down:    `ALTER TABLE tasks DROP COLUMN IF EXISTS deleted_at;`,
+	},
+	{
+		Version: 5,
+		Name:    "add_tasks_version",
+		Up:      `ALTER TABLE tasks ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;`,
+		Down:    `ALTER TABLE tasks DROP COLUMN IF EXISTS version;`,
+	},
+	{
+		Version: 6,
+		Name:    "create_idempotency_keys",
+		Up: `CREATE TABLE IF NOT EXISTS idempotency_keys (
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			key VARCHAR(255) NOT NULL,
+			task_id UUID REFERENCES tasks(id) ON DELETE CASCADE,
+			created_at TIMESTAMP DEFAULT NOW(),
+			PRIMARY KEY (user_id, key)
+		);`,
+		Down: `DROP TABLE IF EXISTS idempotency_keys;`,
+	},
+	{
+		Version: 7,
+		Name:    "add_tasks_priority",
+		Up:      `ALTER TABLE tasks ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 0;`,
+		Down:    `ALTER TABLE tasks DROP COLUMN IF EXISTS priority;`,
+	},
+	{
+		Version: 8,
+		Name:    "add_tasks_due_date",
+		Up:      `ALTER TABLE tasks ADD COLUMN IF NOT EXISTS due_date TIMESTAMP;`,
+		Down:    `ALTER TABLE tasks DROP COLUMN IF EXISTS due_date;`,
+	},
+	{
+		Version: 9,
+		Name:    "create_password_resets",
+		Up: `CREATE TABLE IF NOT EXISTS password_resets (
+			token_hash CHAR(64) PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_password_resets_user_id ON password_resets(user_id);`,
+		Down: `DROP TABLE IF EXISTS password_resets;`,
+	},
+	{
+		Version: 10,
+		Name:    "create_api_keys",
+		Up: `CREATE TABLE IF NOT EXISTS api_keys (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			key_hash CHAR(64) UNIQUE NOT NULL,
+			label VARCHAR(255) NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT NOW(),
+			last_used_at TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);`,
+		Down: `DROP TABLE IF EXISTS api_keys;`,
+	},
+	{
+		Version: 11,
+		Name:    "add_tasks_tags",
+		Up: `ALTER TABLE tasks ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+		CREATE INDEX IF NOT EXISTS idx_tasks_tags ON tasks USING GIN (tags);`,
+		Down: `DROP INDEX IF EXISTS idx_tasks_tags;
+			ALTER TABLE tasks DROP COLUMN IF EXISTS tags;`,
+	},
+	{
+		Version: 12,
+		Name:    "add_tasks_recurrence",
+		Up: `ALTER TABLE tasks ADD COLUMN IF NOT EXISTS recurrence VARCHAR(10) NOT NULL DEFAULT 'none';
+		ALTER TABLE tasks ADD COLUMN IF NOT EXISTS next_run_at TIMESTAMP;
+		CREATE INDEX IF NOT EXISTS idx_tasks_next_run_at ON tasks(next_run_at) WHERE next_run_at IS NOT NULL;`,
+		Down: `DROP INDEX IF EXISTS idx_tasks_next_run_at;
+			ALTER TABLE tasks DROP COLUMN IF EXISTS next_run_at;
+			ALTER TABLE tasks DROP COLUMN IF EXISTS recurrence;`,
+	},
+	{
+		Version: 13,
+		Name:    "create_task_status_history",
+		Up: `CREATE TABLE IF NOT EXISTS task_status_history (
+			id BIGSERIAL PRIMARY KEY,
+			task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+			old_status VARCHAR(50) NOT NULL,
+			new_status VARCHAR(50) NOT NULL,
+			changed_by VARCHAR(255) NOT NULL,
+			changed_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_task_status_history_task_id ON task_status_history(task_id, changed_at DESC);`,
+		Down: `DROP TABLE IF EXISTS task_status_history;`,
+	},
+	{
+		Version: 14,
+		Name:    "add_tasks_archived_at",
+		Up:      `ALTER TABLE tasks ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP;`,
+		Down:    `ALTER TABLE tasks DROP COLUMN IF EXISTS archived_at;`,
+	},
+	{
+		// Existing values are read in the session time zone, which the
+		// connection sets to UTC
+		Version: 15,
+		Name:    "use_timestamptz",
+		Up: `ALTER TABLE users
+			ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+		ALTER TABLE tasks
+			ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+			ALTER COLUMN updated_at TYPE TIMESTAMPTZ,
+			ALTER COLUMN deleted_at TYPE TIMESTAMPTZ,
+			ALTER COLUMN due_date TYPE TIMESTAMPTZ,
+			ALTER COLUMN next_run_at TYPE TIMESTAMPTZ,
+			ALTER COLUMN archived_at TYPE TIMESTAMPTZ;
+		ALTER TABLE idempotency_keys
+			ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+		ALTER TABLE password_resets
+			ALTER COLUMN expires_at TYPE TIMESTAMPTZ,
+			ALTER COLUMN used_at TYPE TIMESTAMPTZ,
+			ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+		ALTER TABLE api_keys
+			ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+			ALTER COLUMN last_used_at TYPE TIMESTAMPTZ;
+		ALTER TABLE task_status_history
+			ALTER COLUMN changed_at TYPE TIMESTAMPTZ;`,
+		Down: `ALTER TABLE users
+			ALTER COLUMN created_at TYPE TIMESTAMP;
+		ALTER TABLE tasks
+			ALTER COLUMN created_at TYPE TIMESTAMP,
+			ALTER COLUMN updated_at TYPE TIMESTAMP,
+			ALTER COLUMN deleted_at TYPE TIMESTAMP,
+			ALTER COLUMN due_date TYPE TIMESTAMP,
+			ALTER COLUMN next_run_at TYPE TIMESTAMP,
+			ALTER COLUMN archived_at TYPE TIMESTAMP;
+		ALTER TABLE idempotency_keys
+			ALTER COLUMN created_at TYPE TIMESTAMP;
+		ALTER TABLE password_resets
+			ALTER COLUMN expires_at TYPE TIMESTAMP,
+			ALTER COLUMN used_at TYPE TIMESTAMP,
+			ALTER COLUMN created_at TYPE TIMESTAMP;
+		ALTER TABLE api_keys
+			ALTER COLUMN created_at TYPE TIMESTAMP,
+			ALTER COLUMN last_used_at TYPE TIMESTAMP;
+		ALTER TABLE task_status_history
+			ALTER COLUMN changed_at TYPE TIMESTAMP;`,
+	},
+	{
+		Version: 16,
+		Name:    "add_tasks_auto_complete",
+		Up:      `ALTER TABLE tasks ADD COLUMN IF NOT EXISTS auto_complete BOOLEAN NOT NULL DEFAULT TRUE;`,
+		Down:    `ALTER TABLE tasks DROP COLUMN IF EXISTS auto_complete;`,
+	},
+	{
+		// Accounts that predate verification are treated as verified, so
+		// turning on REQUIRE_EMAIL_VERIFICATION doesn't lock them out
+		Version: 17,
+		Name:    "add_email_verification",
+		Up: `ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+		UPDATE users SET email_verified = TRUE;
+		CREATE TABLE IF NOT EXISTS email_verifications (
+			token_hash CHAR(64) PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			expires_at TIMESTAMPTZ NOT NULL,
+			used_at TIMESTAMPTZ,
+			created_at TIMESTAMPTZ DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_email_verifications_user_id ON email_verifications(user_id);`,
+		Down: `DROP TABLE IF EXISTS email_verifications;
+			ALTER TABLE users DROP COLUMN IF EXISTS email_verified;`,
+	},
+	{
+		// The limit is config.MaxDescriptionLengthLimit; on startup
+		// DB.SyncDescriptionLength replaces it with MAX_DESCRIPTION_LENGTH.
+		// NOT VALID skips checking existing rows, so oversized descriptions
+		// written before the limit don't block the migration; new writes are
+		// still checked.
+		Version: 18,
+		Name:    "add_tasks_description_length_check",
+		Up: `ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_description_length;
+		ALTER TABLE tasks ADD CONSTRAINT tasks_description_length CHECK (char_length(description) <= 10000) NOT VALID;`,
+		Down: `ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_description_length;`,
+	},
+	{
+		Version: 19,
+		Name:    "add_users_last_login_at",
+		Up:      `ALTER TABLE users ADD COLUMN IF NOT EXISTS last_login_at TIMESTAMPTZ;`,
+		Down:    `ALTER TABLE users DROP COLUMN IF EXISTS last_login_at;`,
+	},
+}
@@ -0,0 +1,14 @@
+package database
+
+import "testing"
+
+func TestMigrationsAreOrdered(t *testing.T) {
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Errorf("migration %q has version %d, want %d", migration.Name, migration.Version, i+1)
+		}
+		if migration.Name == "" || migration.Up == "" || migration.Down == "" {
+			t.Errorf("migration %d must have a name, Up and Down", migration.Version)
+		}
+	}
+}
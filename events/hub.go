@@ -0,0 +1,83 @@
+package events
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// TypeTaskStatusChanged is published when a task moves to a new status
+const TypeTaskStatusChanged = "task.status_changed"
+
+// subscriberBuffer is how many events a slow subscriber may fall behind by
+// before further events to it are dropped
+const subscriberBuffer = 16
+
+// TaskEvent describes a change to one of a user's tasks
+type TaskEvent struct {
+	Type           string    `json:"type"`
+	TaskID         string    `json:"task_id"`
+	Status         string    `json:"status"`
+	PreviousStatus string    `json:"previous_status"`
+	Source         string    `json:"source"` // "user" or "worker"
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// Hub is an in-process pub/sub of task events keyed by the owning user.
+// Events are only delivered to subscribers in this process.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan TaskEvent]struct{}
+}
+
+// NewHub creates an empty hub
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[string]map[chan TaskEvent]struct{})}
+}
+
+// Subscribe registers a subscriber for a user's events. The returned cancel
+// function unregisters it and closes the channel; it must be called once the
+// subscriber is done.
+func (h *Hub) Subscribe(userID string) (<-chan TaskEvent, func()) {
+	ch := make(chan TaskEvent, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan TaskEvent]struct{})
+	}
+	h.subscribers[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers[userID], ch)
+			if len(h.subscribers[userID]) == 0 {
+				delete(h.subscribers, userID)
+			}
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+// Publish sends an event to every subscriber for the user without blocking.
+// A nil hub is a no-op.
+func (h *Hub) Publish(userID string, event TaskEvent) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[userID] {
+		select {
+		case ch <- event:
+		default:
+			slog.Warn("Dropping task event for slow subscriber", "user_id", userID, "task_id", event.TaskID)
+		}
+	}
+}
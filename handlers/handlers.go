@@ -1,200 +1,1575 @@
 package handlers
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
 	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gorilla/mux"
+	"taskapi/config"
+	"taskapi/database"
+	"taskapi/events"
 	"taskapi/middleware"
 	"taskapi/models"
+	"taskapi/repositories"
 	"taskapi/services"
+	"taskapi/worker"
 )
 
 // AuthHandler handles authentication endpoints
 type AuthHandler struct {
 	userService *services.UserService
+	cfg         *config.Config
 }
 
 // NewAuthHandler creates a new auth handler
-func NewAuthHandler(userService *services.UserService) *AuthHandler {
-	return &AuthHandler{userService: userService}
+func NewAuthHandler(userService *services.UserService, cfg *config.Config) *AuthHandler {
+	return &AuthHandler{userService: userService, cfg: cfg}
 }
 
 // Register handles user registration
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var req models.RegisterRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "Invalid request body")
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
 		return
 	}
 
-	resp, err := h.userService.Register(&req)
+	resp, err := h.userService.Register(r.Context(), &req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	middleware.SetAuthCookie(w, resp.Token, h.cfg)
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// Login handles user login
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req models.LoginRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	resp, err := h.userService.Login(&req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	middleware.SetAuthCookie(w, resp.Token, h.cfg)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Logout clears the auth cookie. Tokens are stateless, so a token the client
+// kept elsewhere stays valid until it expires.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	middleware.ClearAuthCookie(w)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Logged out"})
+}
+
+// ForgotPassword starts a password reset. The response is the same whether
+// or not the email is registered.
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ForgotPasswordRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	if err := h.userService.ForgotPassword(r.Context(), &req); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "If that email is registered, a reset link has been sent"})
+}
+
+// ResetPassword completes a password reset with a token
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ResetPasswordRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	if err := h.userService.ResetPassword(r.Context(), &req); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Password has been reset"})
+}
+
+// VerifyEmail confirms the caller's email with the token from the
+// verification link
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if err := h.userService.VerifyEmail(r.Context(), r.URL.Query().Get("token")); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Email address has been verified"})
+}
+
+// ResendVerification issues a new email verification token for the
+// authenticated user
+func (h *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.userService.ResendEmailVerification(r.Context(), claims.UserID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"message": "A new verification link has been sent"})
+}
+
+// Me returns the authenticated user's account
+func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	user, err := h.userService.GetUser(claims.UserID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+// UpdateProfile changes the authenticated user's email or username
+func (h *AuthHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.UpdateProfileRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	resp, err := h.userService.UpdateProfile(r.Context(), claims.UserID, &req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	middleware.SetAuthCookie(w, resp.Token, h.cfg)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// DeleteAccount deletes the authenticated user's own account
+func (h *AuthHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.DeleteAccountRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	if err := h.userService.DeleteAccount(r.Context(), claims.UserID, &req); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	middleware.ClearAuthCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateAPIKey issues a new API key for the authenticated user
+func (h *AuthHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	resp, err := h.userService.CreateAPIKey(claims.UserID, &req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// ListAPIKeys lists the authenticated user's API keys
+func (h *AuthHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	keys, err := h.userService.ListAPIKeys(claims.UserID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// RevokeAPIKey deletes one of the authenticated user's API keys
+func (h *AuthHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	keyID, ok := pathID(w, r, "API key")
+	if !ok {
+		return
+	}
+
+	if err := h.userService.RevokeAPIKey(claims.UserID, keyID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "API key revoked"})
+}
+
+// UserHandler handles admin user-management endpoints
+type UserHandler struct {
+	userService *services.UserService
+}
+
+// NewUserHandler creates a new user handler
+func NewUserHandler(userService *services.UserService) *UserHandler {
+	return &UserHandler{userService: userService}
+}
+
+// UserListResponse is the v2 user list envelope
+type UserListResponse struct {
+	Data       []*models.User `json:"data"`
+	Pagination Pagination     `json:"pagination"`
+}
+
+// ListUsers handles listing users with search, sorting and limit/offset
+// pagination. The total is sent in X-Total-Count, and in the v2 envelope
+// when the client asks for it.
+func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseUserFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := h.userService.ListUsers(r.Context(), filter)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	users := page.Users
+	if users == nil {
+		users = []*models.User{}
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	w.Header().Set("X-Page-Size", strconv.Itoa(page.Limit))
+	if !wantsTaskListV2(r) {
+		writeJSON(w, http.StatusOK, users)
+		return
+	}
+
+	w.Header().Set("Vary", "Accept")
+	writeJSON(w, http.StatusOK, UserListResponse{
+		Data: users,
+		Pagination: Pagination{
+			Total:   page.Total,
+			Limit:   page.Limit,
+			Offset:  page.Offset,
+			HasMore: page.Offset+len(users) < page.Total,
+		},
+	})
+}
+
+// parseUserFilter reads the search, sorting and paging query parameters of
+// a user list request
+func parseUserFilter(r *http.Request) (models.UserFilter, error) {
+	query := r.URL.Query()
+	filter := models.UserFilter{Sort: query.Get("sort")}
+
+	var err error
+	if filter.Search, err = parseSearchParam(r); err != nil {
+		return filter, err
+	}
+	if filter.Limit, err = parseIntParam(r, "limit"); err != nil {
+		return filter, err
+	}
+	if query.Has("limit") && filter.Limit <= 0 {
+		return filter, errors.New("limit must be greater than zero")
+	}
+	if filter.Offset, err = parseIntParam(r, "offset"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// GetUser handles getting a single user
+func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r, "user")
+	if !ok {
+		return
+	}
+
+	user, err := h.userService.GetUser(userID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+// Impersonate handles issuing an admin a token that acts as another user
+func (h *UserHandler) Impersonate(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID, ok := pathID(w, r, "user")
+	if !ok {
+		return
+	}
+
+	resp, err := h.userService.Impersonate(r.Context(), claims.UserID, userID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// DeleteUser handles deleting a user and their tasks
+func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID, ok := pathID(w, r, "user")
+	if !ok {
+		return
+	}
+
+	err := h.userService.DeleteUser(claims.UserID, userID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "User deleted successfully"})
+}
+
+// UpdateUserRole handles changing a user's role
+func (h *UserHandler) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r, "user")
+	if !ok {
+		return
+	}
+
+	var req models.UpdateUserRoleRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	user, err := h.userService.UpdateUserRole(r.Context(), userID, req.Role)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+// TaskHandler handles task endpoints
+type TaskHandler struct {
+	taskService *services.TaskService
+	hub         *events.Hub
+	// legacyDelete answers DELETE /api/tasks/{id} with 200 and a message
+	// body instead of 204, for clients written against the old behaviour
+	legacyDelete bool
+}
+
+// NewTaskHandler creates a new task handler
+func NewTaskHandler(taskService *services.TaskService, hub *events.Hub, cfg *config.Config) *TaskHandler {
+	return &TaskHandler{taskService: taskService, hub: hub, legacyDelete: cfg.LegacyDeleteResponse}
+}
+
+// writeCreatedTask responds 201 Created with the task and a Location header
+// pointing at it
+func writeCreatedTask(w http.ResponseWriter, task *models.Task) {
+	w.Header().Set("Location", "/api/tasks/"+task.ID)
+	writeJSON(w, http.StatusCreated, task)
+}
+
+// streamKeepAlive is how often an idle event stream sends a comment line so
+// proxies don't close the connection
+const streamKeepAlive = 15 * time.Second
+
+// StreamTasks streams the caller's task status changes as Server-Sent Events
+func (h *TaskHandler) StreamTasks(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Streaming unsupported")
+		return
+	}
+
+	eventsCh, cancel := h.hub.Subscribe(claims.UserID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // disable nginx response buffering
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case event := <-eventsCh:
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// CreateTask handles task creation
+func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.CreateTaskRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		task, replayed, err := h.taskService.CreateTaskIdempotent(r.Context(), claims.UserID, key, &req, claims.Role == "admin")
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		if replayed {
+			w.Header().Set("Idempotent-Replayed", "true")
+		}
+		writeCreatedTask(w, task)
+		return
+	}
+
+	task, err := h.taskService.CreateTask(r.Context(), claims.UserID, &req, claims.Role == "admin")
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeCreatedTask(w, task)
+}
+
+// CreateTasks handles bulk task creation
+func (h *TaskHandler) CreateTasks(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var reqs []models.CreateTaskRequest
+	if err := decodeJSON(r, &reqs); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	tasks, err := h.taskService.CreateTasks(r.Context(), claims.UserID, reqs, claims.Role == "admin")
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, tasks)
+}
+
+// GetTask handles getting a single task
+func (h *TaskHandler) GetTask(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	taskID, ok := pathID(w, r, "task")
+	if !ok {
+		return
+	}
+
+	includeOwner, err := parseIncludeOwner(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	task, err := h.taskService.GetTask(claims.UserID, taskID, claims.Role == models.RoleAdmin, claims.Role == models.RoleViewer, includeOwner)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	etag := taskETag(task)
+	w.Header().Set("ETag", etag)
+	if match := r.Header.Get("If-None-Match"); match != "" && match == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, task)
+}
+
+// GetTaskHistory handles listing a task's status changes
+func (h *TaskHandler) GetTaskHistory(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	taskID, ok := pathID(w, r, "task")
+	if !ok {
+		return
+	}
+
+	history, err := h.taskService.GetTaskHistory(claims.UserID, taskID, canReadAllTasks(claims))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, history)
+}
+
+// canReadAllTasks reports whether the caller may read every user's tasks,
+// as admins and viewers can
+func canReadAllTasks(claims *middleware.Claims) bool {
+	return claims.Role == models.RoleAdmin || claims.Role == models.RoleViewer
+}
+
+// GetTasks handles getting all tasks for the user, or all tasks for admins and viewers
+func (h *TaskHandler) GetTasks(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	filter, err := parseTaskFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.CountTotal = wantsTaskListV2(r)
+
+	var page *models.TaskPage
+
+	if canReadAllTasks(claims) {
+		page, err = h.taskService.GetAllTasks(filter, claims.Role == models.RoleAdmin)
+	} else {
+		page, err = h.taskService.GetUserTasks(claims.UserID, filter)
+	}
+
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeTaskPage(w, r, filter, page)
+}
+
+// GetAllTasks handles getting every task (admin-only route)
+func (h *TaskHandler) GetAllTasks(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseTaskFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.CountTotal = wantsTaskListV2(r)
+
+	page, err := h.taskService.GetAllTasks(filter, true)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeTaskPage(w, r, filter, page)
+}
+
+// TaskListV2MediaType selects the paginated envelope for task lists, and for
+// the admin user list
+const TaskListV2MediaType = "application/vnd.taskapi.v2+json"
+
+// wantsTaskListV2 reports whether the client asked for the v2 list envelope
+func wantsTaskListV2(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), TaskListV2MediaType)
+}
+
+// Pagination describes the page returned in a v2 task list
+type Pagination struct {
+	Total      int    `json:"total"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// TaskListResponse is the v2 task list envelope
+type TaskListResponse struct {
+	Data       []*models.Task `json:"data"`
+	Pagination Pagination     `json:"pagination"`
+}
+
+// writeTaskPage writes a page of tasks: a bare JSON array by default, or the
+// v2 envelope with pagination metadata. X-Page-Size reports the limit that
+// was applied and X-Next-Cursor, when set, continues the list.
+func writeTaskPage(w http.ResponseWriter, r *http.Request, filter models.TaskFilter, page *models.TaskPage) {
+	tasks := page.Tasks
+	if tasks == nil {
+		tasks = []*models.Task{}
+	}
+
+	w.Header().Set("X-Page-Size", strconv.Itoa(page.Limit))
+	cursor := nextCursor(filter, page)
+	if cursor != "" {
+		w.Header().Set("X-Next-Cursor", cursor)
+	}
+
+	if !wantsTaskListV2(r) {
+		writeJSON(w, http.StatusOK, tasks)
+		return
+	}
+
+	w.Header().Set("Vary", "Accept")
+	writeJSON(w, http.StatusOK, TaskListResponse{
+		Data: tasks,
+		Pagination: Pagination{
+			Total:      page.Total,
+			Limit:      page.Limit,
+			Offset:     page.Offset,
+			HasMore:    page.HasMore,
+			NextCursor: cursor,
+		},
+	})
+}
+
+// maxSearchLength is the longest search term accepted by task and user lists
+const maxSearchLength = 100
+
+// parseSearchParam reads the optional search query parameter, trimmed of
+// surrounding whitespace
+func parseSearchParam(r *http.Request) (string, error) {
+	search := strings.TrimSpace(r.URL.Query().Get("search"))
+	if utf8.RuneCountInString(search) > maxSearchLength {
+		return "", fmt.Errorf("search must be at most %d characters", maxSearchLength)
+	}
+	if strings.IndexFunc(search, unicode.IsControl) >= 0 {
+		return "", errors.New("search must not contain control characters")
+	}
+	return search, nil
+}
+
+// parseStatusParam reads the status query parameter, which may be repeated
+// or hold comma-separated values. Duplicates are dropped, and no values
+// means no status filter.
+func parseStatusParam(r *http.Request) ([]string, error) {
+	var statuses []string
+	seen := make(map[string]bool)
+	for _, value := range r.URL.Query()["status"] {
+		for _, status := range strings.Split(value, ",") {
+			status = strings.TrimSpace(status)
+			if status == "" || seen[status] {
+				continue
+			}
+			if !models.ValidStatus(status) {
+				return nil, fmt.Errorf("invalid status %q", status)
+			}
+			seen[status] = true
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses, nil
+}
+
+// parseTaskFilter reads the filtering, sorting and paging query parameters
+// of a task list request
+func parseTaskFilter(r *http.Request) (models.TaskFilter, error) {
+	query := r.URL.Query()
+	filter := models.TaskFilter{UserID: query.Get("user_id"), Tag: query.Get("tag"), Sort: query.Get("sort")}
+	if filter.UserID != "" && !isUUID(filter.UserID) {
+		return filter, errors.New("user_id must be a UUID")
+	}
+
+	var err error
+	if filter.Statuses, err = parseStatusParam(r); err != nil {
+		return filter, err
+	}
+	if filter.Search, err = parseSearchParam(r); err != nil {
+		return filter, err
+	}
+	if filter.IncludeOwner, err = parseIncludeOwner(r); err != nil {
+		return filter, err
+	}
+	if filter.CreatedAfter, err = parseTimeParam(r, "created_after"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedBefore, err = parseTimeParam(r, "created_before"); err != nil {
+		return filter, err
+	}
+	if value := query.Get("archived"); value != "" {
+		if filter.Archived, err = strconv.ParseBool(value); err != nil {
+			return filter, errors.New("archived must be true or false")
+		}
+	}
+	if filter.Limit, err = parseIntParam(r, "limit"); err != nil {
+		return filter, err
+	}
+	if query.Has("limit") && filter.Limit <= 0 {
+		return filter, errors.New("limit must be greater than zero")
+	}
+	if filter.Offset, err = parseIntParam(r, "offset"); err != nil {
+		return filter, err
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		if filter.Cursor, err = decodeCursor(cursor); err != nil {
+			return filter, err
+		}
+	}
+	return filter, nil
+}
+
+// pathID returns the {id} path parameter. If it is not a UUID it writes a
+// 400 naming the resource and returns false, so malformed IDs never reach
+// the database.
+func pathID(w http.ResponseWriter, r *http.Request, resource string) (string, bool) {
+	id := mux.Vars(r)["id"]
+	if !isUUID(id) {
+		writeError(w, http.StatusBadRequest, "invalid "+resource+" id")
+		return "", false
+	}
+	return id, true
+}
+
+// isUUID reports whether s is a UUID in the canonical 8-4-4-4-12 hex form
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parseIntParam parses an optional integer query parameter, returning 0 when absent
+func parseIntParam(r *http.Request, param string) (int, error) {
+	value := r.URL.Query().Get(param)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer", param)
+	}
+	return n, nil
+}
+
+// encodeCursor returns the opaque cursor for the page after task
+func encodeCursor(task *models.Task) string {
+	data, _ := json.Marshal(models.TaskCursor{CreatedAt: task.CreatedAt, ID: task.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses a cursor produced by encodeCursor
+func decodeCursor(cursor string) (*models.TaskCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var c models.TaskCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" || c.CreatedAt.IsZero() {
+		return nil, errors.New("invalid cursor")
+	}
+	return &c, nil
+}
+
+// nextCursor returns the cursor for the page after a newest-first page, or
+// "" when no tasks follow it or the list uses another sort
+func nextCursor(filter models.TaskFilter, page *models.TaskPage) string {
+	if !page.HasMore || len(page.Tasks) == 0 {
+		return ""
+	}
+	if filter.Sort != "" && filter.Sort != repositories.DefaultTaskSort {
+		return ""
+	}
+	return encodeCursor(page.Tasks[len(page.Tasks)-1])
+}
+
+// parseIncludeOwner reads the optional include query parameter, a
+// comma-separated list whose only supported value is "owner"
+func parseIncludeOwner(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("include")
+	if value == "" {
+		return false, nil
+	}
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "owner" {
+			return false, fmt.Errorf("unsupported include %q", item)
+		}
+	}
+	return true, nil
+}
+
+// parseTimeParam parses an optional RFC3339 query parameter
+func parseTimeParam(r *http.Request, param string) (*time.Time, error) {
+	value := r.URL.Query().Get(param)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC3339 timestamp", param)
+	}
+	return &t, nil
+}
+
+// GetTaskStats handles getting task counts per status
+func (h *TaskHandler) GetTaskStats(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	counts, err := h.taskService.CountTasksByStatus(r.Context(), claims.UserID, canReadAllTasks(claims))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, counts)
+}
+
+// GetTaskBoard handles getting the caller's tasks grouped by status
+func (h *TaskHandler) GetTaskBoard(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	ownerID := r.URL.Query().Get("user_id")
+	if ownerID != "" && !isUUID(ownerID) {
+		writeError(w, http.StatusBadRequest, "user_id must be a UUID")
+		return
+	}
+	perColumn, err := parseIntParam(r, "per_column")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if r.URL.Query().Has("per_column") && perColumn <= 0 {
+		writeError(w, http.StatusBadRequest, "per_column must be greater than zero")
+		return
+	}
+
+	board, err := h.taskService.GetTaskBoard(r.Context(), claims.UserID, ownerID, canReadAllTasks(claims), perColumn)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, board)
+}
+
+// GetUpcomingTasks handles listing the caller's tasks that are overdue or
+// due soon
+func (h *TaskHandler) GetUpcomingTasks(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var within time.Duration
+	if value := r.URL.Query().Get("within"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, "within must be a positive duration such as 24h")
+			return
+		}
+		within = d
+	}
+	limit, err := parseIntParam(r, "limit")
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	if r.URL.Query().Has("limit") && limit <= 0 {
+		writeError(w, http.StatusBadRequest, "limit must be greater than zero")
+		return
+	}
 
-	writeJSON(w, http.StatusCreated, resp)
+	tasks, err := h.taskService.GetUpcomingTasks(r.Context(), claims.UserID, within, limit)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tasks)
 }
 
-// Login handles user login
-func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
-	var req models.LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "Invalid request body")
+// GetDailyStats handles counting tasks created and completed per day (admin-only route)
+func (h *TaskHandler) GetDailyStats(w http.ResponseWriter, r *http.Request) {
+	from, err := parseDateParam(r, "from")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	to, err := parseDateParam(r, "to")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	resp, err := h.userService.Login(&req)
+	counts, err := h.taskService.CountTasksByDay(r.Context(), from, to)
 	if err != nil {
-		writeError(w, http.StatusUnauthorized, err.Error())
+		writeServiceError(w, err)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, resp)
+	writeJSON(w, http.StatusOK, counts)
 }
 
-// TaskHandler handles task endpoints
-type TaskHandler struct {
-	taskService *services.TaskService
+// parseDateParam parses an optional YYYY-MM-DD query parameter as midnight UTC
+func parseDateParam(r *http.Request, param string) (*time.Time, error) {
+	value := r.URL.Query().Get(param)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a date in YYYY-MM-DD form", param)
+	}
+	return &t, nil
 }
 
-// NewTaskHandler creates a new task handler
-func NewTaskHandler(taskService *services.TaskService) *TaskHandler {
-	return &TaskHandler{taskService: taskService}
+// UpdateTask handles task updates
+func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	taskID, ok := pathID(w, r, "task")
+	if !ok {
+		return
+	}
+
+	var req models.UpdateTaskRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	// If-Match takes precedence over a version in the body
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" && ifMatch != "*" {
+		version, ok := parseTaskETag(ifMatch)
+		if !ok {
+			writeError(w, http.StatusPreconditionFailed, "If-Match does not match the current task")
+			return
+		}
+		req.Version = version
+	}
+
+	task, err := h.taskService.UpdateTask(r.Context(), claims.UserID, taskID, &req, claims.Role == "admin")
+	if err != nil {
+		if errors.Is(err, repositories.ErrVersionConflict) && ifMatch != "" {
+			writeError(w, http.StatusPreconditionFailed, "If-Match does not match the current task")
+			return
+		}
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", taskETag(task))
+	writeJSON(w, http.StatusOK, task)
 }
 
-// CreateTask handles task creation
-func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
+// DeleteTask handles task deletion
+func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 	claims := middleware.GetUserFromContext(r)
 	if claims == nil {
 		writeError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	var req models.CreateTaskRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "Invalid request body")
+	taskID, ok := pathID(w, r, "task")
+	if !ok {
 		return
 	}
 
-	task, err := h.taskService.CreateTask(claims.UserID, &req)
+	var err error
+	if r.URL.Query().Get("hard") == "true" {
+		err = h.taskService.HardDeleteTask(taskID, claims.Role == "admin")
+	} else {
+		err = h.taskService.DeleteTask(r.Context(), claims.UserID, taskID, claims.Role == "admin")
+	}
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+		writeServiceError(w, err)
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, task)
+	if h.legacyDelete {
+		writeJSON(w, http.StatusOK, map[string]string{"message": "Task deleted successfully"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// GetTask handles getting a single task
-func (h *TaskHandler) GetTask(w http.ResponseWriter, r *http.Request) {
+// RestoreTask handles restoring a soft-deleted task
+func (h *TaskHandler) RestoreTask(w http.ResponseWriter, r *http.Request) {
 	claims := middleware.GetUserFromContext(r)
 	if claims == nil {
 		writeError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	taskID := mux.Vars(r)["id"]
+	taskID, ok := pathID(w, r, "task")
+	if !ok {
+		return
+	}
 
-	task, err := h.taskService.GetTask(taskID)
+	task, err := h.taskService.RestoreTask(claims.UserID, taskID, claims.Role == "admin")
 	if err != nil {
-		writeError(w, http.StatusNotFound, "Task not found")
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, task)
+}
+
+// ForceCompleteTask handles an admin marking any task completed
+func (h *TaskHandler) ForceCompleteTask(w http.ResponseWriter, r *http.Request) {
+	h.forceStatus(w, r, models.StatusCompleted)
+}
+
+// ReopenTask handles an admin moving any task back to pending
+func (h *TaskHandler) ReopenTask(w http.ResponseWriter, r *http.Request) {
+	h.forceStatus(w, r, models.StatusPending)
+}
+
+// forceStatus sets the status of the task in the request path as an admin
+func (h *TaskHandler) forceStatus(w http.ResponseWriter, r *http.Request, status string) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	// Check authorization
-	if claims.Role != "admin" && task.UserID != "" && task.UserID != claims.UserID {
-		writeError(w, http.StatusForbidden, "Unauthorized to access this task")
+	taskID, ok := pathID(w, r, "task")
+	if !ok {
+		return
+	}
+
+	task, err := h.taskService.ForceTaskStatus(r.Context(), claims.UserID, taskID, status)
+	if err != nil {
+		writeServiceError(w, err)
 		return
 	}
 
 	writeJSON(w, http.StatusOK, task)
 }
 
-// GetTasks handles getting all tasks for the user or all tasks if admin
-func (h *TaskHandler) GetTasks(w http.ResponseWriter, r *http.Request) {
+// ArchiveTask handles hiding a task from the default list
+func (h *TaskHandler) ArchiveTask(w http.ResponseWriter, r *http.Request) {
+	h.setArchived(w, r, true)
+}
+
+// UnarchiveTask handles returning an archived task to the default list
+func (h *TaskHandler) UnarchiveTask(w http.ResponseWriter, r *http.Request) {
+	h.setArchived(w, r, false)
+}
+
+// setArchived archives or unarchives the task in the request path
+func (h *TaskHandler) setArchived(w http.ResponseWriter, r *http.Request, archived bool) {
 	claims := middleware.GetUserFromContext(r)
 	if claims == nil {
 		writeError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	var tasks []*models.Task
-	var err error
+	taskID, ok := pathID(w, r, "task")
+	if !ok {
+		return
+	}
 
-	if claims.Role == "admin" {
-		tasks, err = h.taskService.GetAllTasks()
+	var task *models.Task
+	var err error
+	if archived {
+		task, err = h.taskService.ArchiveTask(r.Context(), claims.UserID, taskID, claims.Role == "admin")
 	} else {
-		tasks, err = h.taskService.GetUserTasks(claims.UserID)
+		task, err = h.taskService.UnarchiveTask(r.Context(), claims.UserID, taskID, claims.Role == "admin")
 	}
-
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Error retrieving tasks")
+		writeServiceError(w, err)
 		return
 	}
 
-	if tasks == nil {
-		tasks = []*models.Task{}
+	writeJSON(w, http.StatusOK, task)
+}
+
+// UpdateTasksStatus handles moving several tasks to one status
+func (h *TaskHandler) UpdateTasksStatus(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
 	}
 
-	writeJSON(w, http.StatusOK, tasks)
+	var req models.BulkStatusRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	for _, id := range req.IDs {
+		if !isUUID(id) {
+			writeError(w, http.StatusBadRequest, "invalid task ids")
+			return
+		}
+	}
+
+	resp, err := h.taskService.UpdateTasksStatus(r.Context(), claims.UserID, &req, claims.Role == "admin")
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
 }
 
-// UpdateTask handles task updates
-func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
+// DeleteTasks handles bulk task deletion
+func (h *TaskHandler) DeleteTasks(w http.ResponseWriter, r *http.Request) {
 	claims := middleware.GetUserFromContext(r)
 	if claims == nil {
 		writeError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	taskID := mux.Vars(r)["id"]
+	var req models.BulkDeleteRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	for _, id := range req.IDs {
+		if !isUUID(id) {
+			writeError(w, http.StatusBadRequest, "invalid task ids")
+			return
+		}
+	}
+
+	resp, err := h.taskService.DeleteTasks(r.Context(), claims.UserID, req.IDs, claims.Role == "admin")
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
 
-	var req models.UpdateTaskRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "Invalid request body")
+// TransferTasks handles moving all of a user's tasks to another user
+func (h *TaskHandler) TransferTasks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r, "user")
+	if !ok {
 		return
 	}
 
-	task, err := h.taskService.UpdateTask(claims.UserID, taskID, &req, claims.Role == "admin")
+	var req models.TransferTasksRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	resp, err := h.taskService.TransferTasks(r.Context(), userID, &req)
 	if err != nil {
-		if err.Error() == "unauthorized to update this task" {
-			writeError(w, http.StatusForbidden, err.Error())
-		} else {
-			writeError(w, http.StatusBadRequest, err.Error())
-		}
+		writeServiceError(w, err)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, task)
+	writeJSON(w, http.StatusOK, resp)
 }
 
-// DeleteTask handles task deletion
-func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
+// WorkerHandler handles admin requests about the background worker
+type WorkerHandler struct {
+	worker      *worker.TaskWorker
+	taskService *services.TaskService
+}
+
+// NewWorkerHandler creates a new worker handler
+func NewWorkerHandler(taskWorker *worker.TaskWorker, taskService *services.TaskService) *WorkerHandler {
+	return &WorkerHandler{worker: taskWorker, taskService: taskService}
+}
+
+// Status reports the worker's queue depth and progress
+func (h *WorkerHandler) Status(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.worker.Status())
+}
+
+// submitTimeout bounds how long a submission waits for room in the queue
+const submitTimeout = 5 * time.Second
+
+// SubmitTask queues a task for the worker to auto-complete
+func (h *WorkerHandler) SubmitTask(w http.ResponseWriter, r *http.Request) {
 	claims := middleware.GetUserFromContext(r)
 	if claims == nil {
 		writeError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	taskID := mux.Vars(r)["id"]
+	taskID, ok := pathID(w, r, "task")
+	if !ok {
+		return
+	}
+
+	task, err := h.taskService.GetTask(claims.UserID, taskID, true, false, false)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if !task.AutoComplete {
+		writeError(w, http.StatusConflict, "Task has opted out of auto-completion")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), submitTimeout)
+	defer cancel()
+
+	if err := h.worker.SubmitTask(ctx, taskID); err != nil {
+		switch {
+		case errors.Is(err, worker.ErrChannelFull):
+			writeError(w, http.StatusServiceUnavailable, "Worker queue is full")
+			return
+		case errors.Is(err, worker.ErrWorkerStopped):
+			writeError(w, http.StatusServiceUnavailable, "Worker is stopped")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Error submitting task")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"message": "Task submitted for processing"})
+}
+
+// PreviewAutoCompletion lists the tasks the worker would auto-complete,
+// using the configured age or the one given in the minutes query parameter
+func (h *WorkerHandler) PreviewAutoCompletion(w http.ResponseWriter, r *http.Request) {
+	minutes := 0
+	if value := r.URL.Query().Get("minutes"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "minutes must be a positive integer")
+			return
+		}
+		minutes = n
+	}
 
-	err := h.taskService.DeleteTask(claims.UserID, taskID, claims.Role == "admin")
+	preview, err := h.taskService.PreviewAutoCompletion(r.Context(), minutes)
 	if err != nil {
-		if err.Error() == "unauthorized to delete this task" {
-			writeError(w, http.StatusForbidden, err.Error())
-		} else {
-			writeError(w, http.StatusNotFound, err.Error())
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, preview)
+}
+
+// PurgeCompletedTasks permanently deletes old completed tasks, using the
+// configured age or the one given in the older_than_days query parameter
+func (h *WorkerHandler) PurgeCompletedTasks(w http.ResponseWriter, r *http.Request) {
+	days := 0
+	if value := r.URL.Query().Get("older_than_days"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "older_than_days must be a positive integer")
+			return
 		}
+		days = n
+	}
+
+	result, err := h.taskService.PurgeCompletedTasks(r.Context(), days)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// HealthHandler handles health, liveness and readiness checks
+type HealthHandler struct {
+	db *database.DB
+}
+
+// NewHealthHandler creates a new health handler
+func NewHealthHandler(db *database.DB) *HealthHandler {
+	return &HealthHandler{db: db}
+}
+
+// healthCheckTimeout bounds how long a database ping may take
+const healthCheckTimeout = 2 * time.Second
+
+// Health reports whether the database is reachable
+func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	if err := h.db.Ping(ctx); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "degraded"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Live reports that the process is running
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Ready reports whether the server can handle traffic: migrations have
+// completed and the database is reachable
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	if !h.db.MigrationsApplied() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "not ready", "reason": "migrations pending"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	if err := h.db.Ping(ctx); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "not ready", "reason": "database unreachable"})
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]string{"message": "Task deleted successfully"})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// Migrations reports the applied migrations and how many are pending
+func (h *HealthHandler) Migrations(w http.ResponseWriter, r *http.Request) {
+	status, err := h.db.MigrationStatus(r.Context())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status)
 }
 
 // Helper functions
 
+// taskETag builds a strong ETag from the task version, e.g. "v3".
+// The version only changes when the task changes, so the ETag is stable.
+func taskETag(task *models.Task) string {
+	return `"v` + strconv.Itoa(task.Version) + `"`
+}
+
+// parseTaskETag extracts the version from an ETag produced by taskETag
+func parseTaskETag(etag string) (int, bool) {
+	etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+	if !strings.HasPrefix(etag, `"v`) || !strings.HasSuffix(etag, `"`) {
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(etag, `"v`), `"`))
+	if err != nil {
+		return 0, false
+	}
+	return version, true
+}
+
+// decodeJSON decodes a request body holding a single JSON value into dst,
+// rejecting unknown fields. Its errors name the offending field or position
+// and are safe to return to clients.
+func decodeJSON(r *http.Request, dst interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		var timeErr *time.ParseError
+
+		switch {
+		case errors.As(err, &maxBytesErr):
+			return &bodyTooLargeError{limit: maxBytesErr.Limit}
+		case errors.Is(err, io.EOF):
+			return errors.New("Request body must not be empty")
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("Malformed JSON: unexpected end of request body")
+		case errors.As(err, &syntaxErr):
+			return fmt.Errorf("Malformed JSON at position %d", syntaxErr.Offset)
+		case errors.As(err, &typeErr):
+			if typeErr.Field == "" {
+				return fmt.Errorf("Request body must be a JSON %s", describeJSONType(typeErr.Type))
+			}
+			return fmt.Errorf("Field %q must be %s", typeErr.Field, withArticle(describeJSONType(typeErr.Type)))
+		case errors.As(err, &timeErr):
+			return fmt.Errorf("Invalid timestamp %q, expected RFC3339 (e.g. 2024-01-02T15:04:05Z)", timeErr.Value)
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			return fmt.Errorf("Unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+		default:
+			return errors.New("Invalid request body")
+		}
+	}
+
+	if dec.More() {
+		return errors.New("Request body must contain a single JSON value")
+	}
+	return nil
+}
+
+// bodyTooLargeError is returned by decodeJSON when the body exceeds the
+// limit set by the body limit middleware
+type bodyTooLargeError struct {
+	limit int64
+}
+
+func (e *bodyTooLargeError) Error() string {
+	return fmt.Sprintf("Request body must not exceed %d bytes", e.limit)
+}
+
+// writeDecodeError writes a decodeJSON error: 413 for oversized bodies,
+// 400 otherwise
+func writeDecodeError(w http.ResponseWriter, err error) {
+	var tooLarge *bodyTooLargeError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	writeError(w, http.StatusBadRequest, err.Error())
+}
+
+// describeJSONType names the JSON type a Go type is decoded from
+func describeJSONType(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return "RFC3339 timestamp string"
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array of " + describeJSONType(t.Elem()) + "s"
+	default:
+		return "object"
+	}
+}
+
+// withArticle prefixes a type description with "a" or "an"
+func withArticle(s string) string {
+	if strings.ContainsRune("aeiou", rune(s[0])) {
+		return "an " + s
+	}
+	return "a " + s
+}
+
 func writeJSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
@@ -205,6 +1580,55 @@ type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
+// ValidationErrorResponse is an error response naming each invalid field
+type ValidationErrorResponse struct {
+	Error  string            `json:"error"`
+	Errors map[string]string `json:"errors"`
+}
+
+// BulkErrorResponse is an error response with per-item details
+type BulkErrorResponse struct {
+	Error string                 `json:"error"`
+	Items []models.BulkItemError `json:"items"`
+}
+
 func writeError(w http.ResponseWriter, statusCode int, message string) {
 	writeJSON(w, statusCode, ErrorResponse{Error: message})
 }
+
+// writeServiceError maps an error returned by the services to a response.
+// Errors of a known kind carry a message meant for clients; a lost database
+// connection is a retryable 503; anything else is logged and reported as a
+// plain 500 so database details never leak.
+func writeServiceError(w http.ResponseWriter, err error) {
+	var bulkErr *services.BulkValidationError
+	var validationErr *services.ValidationError
+	var rateLimitErr *services.RateLimitError
+	switch {
+	case database.IsConnectionError(err):
+		slog.Error("Database unavailable", "error", err)
+		w.Header().Set("Retry-After", middleware.DatabaseRetryAfter)
+		writeError(w, http.StatusServiceUnavailable, "Service temporarily unavailable")
+	case errors.As(err, &bulkErr):
+		writeJSON(w, http.StatusBadRequest, BulkErrorResponse{Error: err.Error(), Items: bulkErr.Items})
+	case errors.As(err, &validationErr):
+		writeJSON(w, http.StatusBadRequest, ValidationErrorResponse{Error: err.Error(), Errors: validationErr.Fields})
+	case errors.Is(err, services.ErrValidation):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrUnauthorized):
+		writeError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, services.ErrForbidden):
+		writeError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrConflict):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.As(err, &rateLimitErr):
+		retryAfter := int(math.Ceil(rateLimitErr.RetryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		writeError(w, http.StatusTooManyRequests, err.Error())
+	default:
+		slog.Error("Unhandled service error", "error", err)
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
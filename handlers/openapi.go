@@ -0,0 +1,517 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"taskapi/database"
+	"taskapi/events"
+	"taskapi/middleware"
+	"taskapi/models"
+	"taskapi/repositories"
+	"taskapi/worker"
+)
+
+// object is a JSON object in the OpenAPI document
+type object = map[string]interface{}
+
+// MessageResponse is the body of endpoints that only confirm an action
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// TaskStats is the body of GET /api/tasks/stats
+type TaskStats struct {
+	Pending    int `json:"pending"`
+	InProgress int `json:"in_progress"`
+	Completed  int `json:"completed"`
+	Cancelled  int `json:"cancelled"`
+}
+
+// TaskBoard is the body of GET /api/tasks/board
+type TaskBoard struct {
+	Pending    []models.Task `json:"pending"`
+	InProgress []models.Task `json:"in_progress"`
+	Completed  []models.Task `json:"completed"`
+	Cancelled  []models.Task `json:"cancelled"`
+}
+
+// HealthStatus is the body of the health endpoints
+type HealthStatus struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// schemaTypes are published under components/schemas, named after their Go
+// types. Fields of these types are emitted as references.
+var schemaTypes = []interface{}{
+	models.User{},
+	models.Task{},
+	models.TaskOwner{},
+	models.TaskStatusChange{},
+	models.DailyTaskCount{},
+	models.AutoCompletePreview{},
+	models.PurgeResult{},
+	models.CreateTaskRequest{},
+	models.UpdateTaskRequest{},
+	models.BulkItemError{},
+	models.BulkDeleteRequest{},
+	models.BulkDeleteResponse{},
+	models.BulkStatusRequest{},
+	models.BulkStatusResponse{},
+	models.RegisterRequest{},
+	models.LoginRequest{},
+	models.ForgotPasswordRequest{},
+	models.ResetPasswordRequest{},
+	models.UpdateProfileRequest{},
+	models.DeleteAccountRequest{},
+	models.APIKey{},
+	models.CreateAPIKeyRequest{},
+	models.CreateAPIKeyResponse{},
+	models.UpdateUserRoleRequest{},
+	models.TransferTasksRequest{},
+	models.TransferTasksResponse{},
+	models.AuthResponse{},
+	events.TaskEvent{},
+	middleware.ErrorResponse{},
+	BulkErrorResponse{},
+	ValidationErrorResponse{},
+	SocketStatusUpdate{},
+	SocketReply{},
+	MessageResponse{},
+	TaskStats{},
+	TaskBoard{},
+	HealthStatus{},
+	Pagination{},
+	TaskListResponse{},
+	UserListResponse{},
+	worker.Status{},
+	database.AppliedMigration{},
+	database.MigrationStatus{},
+}
+
+// operation describes one endpoint. body and response are zero values of
+// the request and response types (a slice for arrays); nil means none.
+// altContent lists other media types the success response may be sent as.
+// Error responses use ErrorResponse unless overridden in errorBodies.
+type operation struct {
+	method      string
+	path        string
+	tag         string
+	summary     string
+	auth        bool
+	params      []object
+	body        interface{}
+	status      int
+	response    interface{}
+	contentType string // of the success response; defaults to application/json
+	altContent  map[string]interface{}
+	errors      []int
+	errorBodies map[int]interface{}
+}
+
+// operations lists every endpoint registered in main.go. Keep it in step
+// with the routes there.
+func operations() []operation {
+	id := pathParam("id", "Resource ID (a UUID)")
+	include := queryParam("include", "owner adds each task's owner (id and username); admins always get it, with the email", object{"type": "string", "enum": []string{"owner"}})
+	filters := []object{
+		queryParam("user_id", "Only tasks owned by this user; non-admins may only pass their own ID", object{"type": "string", "format": "uuid"}),
+		queryParam("created_after", "Only tasks created after this RFC3339 time", object{"type": "string", "format": "date-time"}),
+		queryParam("created_before", "Only tasks created before this RFC3339 time", object{"type": "string", "format": "date-time"}),
+		queryParam("tag", "Only tasks with this tag", object{"type": "string"}),
+		queryParam("status", "Only tasks with one of these statuses; repeat the parameter or separate values with commas", object{"type": "array", "items": object{"type": "string", "enum": models.Statuses}}),
+		queryParam("search", "Case-insensitive text to find in the title or description (at most 100 characters)", object{"type": "string", "maxLength": 100}),
+		queryParam("archived", "List archived tasks instead of unarchived ones", object{"type": "boolean", "default": false}),
+		queryParam("sort", "Comma-separated sort fields ("+strings.Join(repositories.TaskSortFields, ", ")+"); a leading - sorts descending", object{"type": "string", "default": repositories.DefaultTaskSort}),
+		queryParam("limit", "Page size; defaults to DEFAULT_PAGE_SIZE and is capped at MAX_PAGE_SIZE", object{"type": "integer", "minimum": 1}),
+		queryParam("offset", "Number of tasks to skip", object{"type": "integer"}),
+		queryParam("cursor", "X-Next-Cursor value from the previous page (default sort only)", object{"type": "string"}),
+		include,
+	}
+
+	return []operation{
+		{method: "POST", path: "/api/auth/register", tag: "auth", summary: "Register a new user",
+			body: models.RegisterRequest{}, status: http.StatusCreated, response: models.AuthResponse{}, errors: []int{400, 429},
+			errorBodies: map[int]interface{}{http.StatusBadRequest: ValidationErrorResponse{}}},
+		{method: "POST", path: "/api/auth/login", tag: "auth", summary: "Log in and receive a token",
+			body: models.LoginRequest{}, status: http.StatusOK, response: models.AuthResponse{}, errors: []int{400, 401, 429},
+			errorBodies: map[int]interface{}{http.StatusBadRequest: ValidationErrorResponse{}}},
+		{method: "POST", path: "/api/auth/logout", tag: "auth", summary: "Clear the auth cookie set when AUTH_COOKIE is enabled",
+			status: http.StatusOK, response: MessageResponse{}, errors: []int{429}},
+		{method: "POST", path: "/api/auth/forgot-password", tag: "auth", summary: "Start a password reset",
+			body: models.ForgotPasswordRequest{}, status: http.StatusOK, response: MessageResponse{}, errors: []int{400, 429}},
+		{method: "POST", path: "/api/auth/reset-password", tag: "auth", summary: "Reset a password with a reset token",
+			body: models.ResetPasswordRequest{}, status: http.StatusOK, response: MessageResponse{}, errors: []int{400, 429}},
+		{method: "GET", path: "/api/auth/verify", tag: "auth", summary: "Verify an email address with a verification token",
+			params: []object{queryParam("token", "Token from the verification link", object{"type": "string"})},
+			status: http.StatusOK, response: MessageResponse{}, errors: []int{400, 429}},
+		{method: "GET", path: "/api/auth/me", tag: "auth", summary: "Get the caller's account", auth: true,
+			status: http.StatusOK, response: models.User{}, errors: []int{401, 404}},
+		{method: "PATCH", path: "/api/auth/me", tag: "auth", summary: "Change the caller's email or username", auth: true,
+			body: models.UpdateProfileRequest{}, status: http.StatusOK, response: models.AuthResponse{}, errors: []int{400, 401, 403, 404, 409}},
+		{method: "DELETE", path: "/api/auth/me", tag: "auth", summary: "Delete the caller's account", auth: true,
+			body: models.DeleteAccountRequest{}, status: http.StatusNoContent, errors: []int{400, 401, 403}},
+		{method: "POST", path: "/api/auth/me/verification", tag: "auth", summary: "Send a new email verification link", auth: true,
+			status: http.StatusAccepted, response: MessageResponse{}, errors: []int{401, 403, 404, 409}},
+		{method: "POST", path: "/api/auth/me/api-keys", tag: "auth", summary: "Create an API key", auth: true,
+			body: models.CreateAPIKeyRequest{}, status: http.StatusCreated, response: models.CreateAPIKeyResponse{}, errors: []int{400, 401, 403}},
+		{method: "GET", path: "/api/auth/me/api-keys", tag: "auth", summary: "List the caller's API keys", auth: true,
+			status: http.StatusOK, response: []models.APIKey{}, errors: []int{401}},
+		{method: "DELETE", path: "/api/auth/me/api-keys/{id}", tag: "auth", summary: "Revoke an API key", auth: true,
+			params: []object{id}, status: http.StatusOK, response: MessageResponse{}, errors: []int{400, 401, 403, 404}},
+
+		{method: "POST", path: "/api/tasks", tag: "tasks", summary: "Create a task", auth: true,
+			params: []object{headerParam("Idempotency-Key", "Makes retries of this request safe")},
+			body:   models.CreateTaskRequest{}, status: http.StatusCreated, response: models.Task{}, errors: []int{400, 401, 403, 409, 413, 429},
+			errorBodies: map[int]interface{}{http.StatusBadRequest: ValidationErrorResponse{}}},
+		{method: "GET", path: "/api/tasks", tag: "tasks", summary: "List the caller's tasks (all tasks for admins)", auth: true,
+			params: filters, status: http.StatusOK, response: []models.Task{}, errors: []int{400, 401, 403},
+			altContent: map[string]interface{}{TaskListV2MediaType: TaskListResponse{}}},
+		{method: "GET", path: "/api/tasks/stats", tag: "tasks", summary: "Count tasks per status", auth: true,
+			status: http.StatusOK, response: TaskStats{}, errors: []int{401, 403}},
+		{method: "GET", path: "/api/tasks/board", tag: "tasks", summary: "List the caller's tasks grouped by status", auth: true,
+			params: []object{
+				queryParam("user_id", "Show this user's board instead (admin only, unless it is the caller)", object{"type": "string", "format": "uuid"}),
+				queryParam("per_column", "Most tasks per status; defaults to DEFAULT_PAGE_SIZE and is capped at MAX_PAGE_SIZE", object{"type": "integer", "minimum": 1}),
+			},
+			status: http.StatusOK, response: TaskBoard{}, errors: []int{400, 401, 403}},
+		{method: "GET", path: "/api/tasks/upcoming", tag: "tasks", summary: "List the caller's open tasks that are overdue or due soon, soonest first", auth: true,
+			params: []object{
+				queryParam("within", "Go duration such as 24h or 90m; defaults to 24h and may be at most 720h", object{"type": "string", "default": "24h"}),
+				queryParam("limit", "Most tasks to return; defaults to DEFAULT_PAGE_SIZE and is capped at MAX_PAGE_SIZE", object{"type": "integer", "minimum": 1}),
+			},
+			status: http.StatusOK, response: []models.Task{}, errors: []int{400, 401, 403}},
+		{method: "GET", path: "/api/tasks/stream", tag: "tasks", summary: "Stream task status changes as Server-Sent Events", auth: true,
+			status: http.StatusOK, response: events.TaskEvent{}, contentType: "text/event-stream", errors: []int{401, 403}},
+		{method: "GET", path: "/api/tasks/ws", tag: "tasks", summary: "Open a WebSocket that carries task events and accepts SocketStatusUpdate messages", auth: true,
+			params: []object{queryParam("access_token", "JWT, for clients that cannot send the Authorization header", object{"type": "string"})},
+			status: http.StatusSwitchingProtocols, errors: []int{400, 401, 403}},
+		{method: "POST", path: "/api/tasks/bulk", tag: "tasks", summary: "Create several tasks atomically", auth: true,
+			body: []models.CreateTaskRequest{}, status: http.StatusCreated, response: []models.Task{}, errors: []int{400, 401, 403, 409, 413, 429},
+			errorBodies: map[int]interface{}{http.StatusBadRequest: BulkErrorResponse{}}},
+		{method: "POST", path: "/api/tasks/bulk-delete", tag: "tasks", summary: "Delete several tasks", auth: true,
+			body: models.BulkDeleteRequest{}, status: http.StatusOK, response: models.BulkDeleteResponse{}, errors: []int{400, 401, 403}},
+		{method: "PATCH", path: "/api/tasks/status", tag: "tasks", summary: "Move several tasks to one status", auth: true,
+			body: models.BulkStatusRequest{}, status: http.StatusOK, response: models.BulkStatusResponse{}, errors: []int{400, 401, 403, 409}},
+		{method: "GET", path: "/api/tasks/{id}", tag: "tasks", summary: "Get a task", auth: true,
+			params: []object{id, include, headerParam("If-None-Match", "ETag from an earlier response")},
+			status: http.StatusOK, response: models.Task{}, errors: []int{400, 401, 403, 404}},
+		{method: "PUT", path: "/api/tasks/{id}", tag: "tasks", summary: "Update a task", auth: true,
+			params: []object{id, headerParam("If-Match", "Only update if the task still has this ETag")},
+			body:   models.UpdateTaskRequest{}, status: http.StatusOK, response: models.Task{}, errors: []int{400, 401, 403, 404, 409, 412},
+			errorBodies: map[int]interface{}{http.StatusBadRequest: ValidationErrorResponse{}}},
+		{method: "DELETE", path: "/api/tasks/{id}", tag: "tasks", summary: "Delete a task", auth: true,
+			params: []object{id, queryParam("hard", "Permanently delete (admin only)", object{"type": "boolean"})},
+			status: http.StatusNoContent, errors: []int{400, 401, 403, 404}},
+		{method: "POST", path: "/api/tasks/{id}/restore", tag: "tasks", summary: "Restore a deleted task", auth: true,
+			params: []object{id}, status: http.StatusOK, response: models.Task{}, errors: []int{400, 401, 403, 404, 409}},
+		{method: "POST", path: "/api/tasks/{id}/archive", tag: "tasks", summary: "Archive a task", auth: true,
+			params: []object{id}, status: http.StatusOK, response: models.Task{}, errors: []int{400, 401, 403, 404}},
+		{method: "POST", path: "/api/tasks/{id}/unarchive", tag: "tasks", summary: "Unarchive a task", auth: true,
+			params: []object{id}, status: http.StatusOK, response: models.Task{}, errors: []int{400, 401, 403, 404}},
+		{method: "GET", path: "/api/tasks/{id}/history", tag: "tasks", summary: "List a task's status changes", auth: true,
+			params: []object{id}, status: http.StatusOK, response: []models.TaskStatusChange{}, errors: []int{400, 401, 403, 404}},
+
+		{method: "GET", path: "/api/admin/tasks", tag: "admin", summary: "List all tasks with their owners", auth: true,
+			params: filters, status: http.StatusOK, response: []models.Task{}, errors: []int{400, 401, 403},
+			altContent: map[string]interface{}{TaskListV2MediaType: TaskListResponse{}}},
+		{method: "GET", path: "/api/admin/stats/daily", tag: "admin", summary: "Count tasks created and completed per day", auth: true,
+			params: []object{
+				queryParam("from", "First day (YYYY-MM-DD, UTC); defaults to 29 days before to", object{"type": "string", "format": "date"}),
+				queryParam("to", "Last day (YYYY-MM-DD, UTC); defaults to today", object{"type": "string", "format": "date"}),
+			},
+			status: http.StatusOK, response: []models.DailyTaskCount{}, errors: []int{400, 401, 403}},
+		{method: "POST", path: "/api/admin/tasks/{id}/complete", tag: "admin", summary: "Mark any task completed", auth: true,
+			params: []object{id}, status: http.StatusOK, response: models.Task{}, errors: []int{400, 401, 403, 404}},
+		{method: "POST", path: "/api/admin/tasks/{id}/reopen", tag: "admin", summary: "Move any task back to pending", auth: true,
+			params: []object{id}, status: http.StatusOK, response: models.Task{}, errors: []int{400, 401, 403, 404}},
+		{method: "POST", path: "/api/admin/tasks/{id}/submit", tag: "admin", summary: "Queue a task for the worker to auto-complete", auth: true,
+			params: []object{id}, status: http.StatusAccepted, response: MessageResponse{}, errors: []int{400, 401, 403, 404, 503}},
+		{method: "GET", path: "/api/admin/worker", tag: "admin", summary: "Report the background worker's queue depth and progress", auth: true,
+			status: http.StatusOK, response: worker.Status{}, errors: []int{401, 403}},
+		{method: "GET", path: "/api/admin/migrations", tag: "admin", summary: "List applied schema migrations and count pending ones", auth: true,
+			status: http.StatusOK, response: database.MigrationStatus{}, errors: []int{401, 403, 503}},
+		{method: "POST", path: "/api/admin/tasks/purge", tag: "admin", summary: "Permanently delete old completed tasks", auth: true,
+			params: []object{
+				queryParam("older_than_days", "Only tasks completed more than this many days ago; defaults to PURGE_COMPLETED_AFTER_DAYS", object{"type": "integer", "minimum": 1}),
+			},
+			status: http.StatusOK, response: models.PurgeResult{}, errors: []int{400, 401, 403}},
+		{method: "GET", path: "/api/admin/auto-complete/preview", tag: "admin", summary: "List the tasks the worker would auto-complete, without completing them", auth: true,
+			params: []object{
+				queryParam("minutes", "Task age in minutes; defaults to AUTO_COMPLETE_MINUTES", object{"type": "integer", "minimum": 1}),
+			},
+			status: http.StatusOK, response: models.AutoCompletePreview{}, errors: []int{400, 401, 403}},
+		{method: "GET", path: "/api/admin/users", tag: "admin", summary: "List users", auth: true,
+			params: []object{
+				queryParam("search", "Case-insensitive text to find in the email or username (at most 100 characters)", object{"type": "string", "maxLength": 100}),
+				queryParam("sort", "Comma-separated sort fields ("+strings.Join(repositories.UserSortFields, ", ")+"); a leading - sorts descending", object{"type": "string", "default": repositories.DefaultUserSort}),
+				queryParam("limit", "Page size (max 100)", object{"type": "integer", "default": 20, "minimum": 1}),
+				queryParam("offset", "Number of users to skip", object{"type": "integer", "default": 0, "minimum": 0}),
+			},
+			status: http.StatusOK, response: []models.User{}, errors: []int{400, 401, 403},
+			altContent: map[string]interface{}{TaskListV2MediaType: UserListResponse{}}},
+		{method: "GET", path: "/api/admin/users/{id}", tag: "admin", summary: "Get a user", auth: true,
+			params: []object{id}, status: http.StatusOK, response: models.User{}, errors: []int{400, 401, 403, 404}},
+		{method: "DELETE", path: "/api/admin/users/{id}", tag: "admin", summary: "Delete a user", auth: true,
+			params: []object{id}, status: http.StatusOK, response: MessageResponse{}, errors: []int{400, 401, 403, 404}},
+		{method: "PUT", path: "/api/admin/users/{id}/role", tag: "admin", summary: "Change a user's role", auth: true,
+			params: []object{id}, body: models.UpdateUserRoleRequest{}, status: http.StatusOK, response: models.User{}, errors: []int{400, 401, 403, 404}},
+		{method: "POST", path: "/api/admin/users/{id}/impersonate", tag: "admin", summary: "Issue a short-lived token that acts as a user", auth: true,
+			params: []object{id}, status: http.StatusOK, response: models.AuthResponse{}, errors: []int{400, 401, 403, 404}},
+		{method: "POST", path: "/api/admin/users/{id}/transfer-tasks", tag: "admin", summary: "Move all of a user's tasks to another user", auth: true,
+			params: []object{id}, body: models.TransferTasksRequest{}, status: http.StatusOK, response: models.TransferTasksResponse{}, errors: []int{400, 401, 403, 404, 409},
+			errorBodies: map[int]interface{}{http.StatusBadRequest: ValidationErrorResponse{}}},
+
+		{method: "GET", path: "/health", tag: "health", summary: "Report whether the database is reachable",
+			status: http.StatusOK, response: HealthStatus{}, errors: []int{503},
+			errorBodies: map[int]interface{}{http.StatusServiceUnavailable: HealthStatus{}}},
+		{method: "GET", path: "/live", tag: "health", summary: "Liveness probe",
+			status: http.StatusOK, response: HealthStatus{}},
+		{method: "GET", path: "/ready", tag: "health", summary: "Readiness probe",
+			status: http.StatusOK, response: HealthStatus{}, errors: []int{503},
+			errorBodies: map[int]interface{}{http.StatusServiceUnavailable: HealthStatus{}}},
+	}
+}
+
+// BuildOpenAPISpec returns the OpenAPI 3 document for the API
+func BuildOpenAPISpec() object {
+	schemas := object{}
+	for _, v := range schemaTypes {
+		t := reflect.TypeOf(v)
+		schemas[t.Name()] = structSchema(t)
+	}
+
+	paths := object{}
+	for _, op := range operations() {
+		item, ok := paths[op.path].(object)
+		if !ok {
+			item = object{}
+			paths[op.path] = item
+		}
+		item[strings.ToLower(op.method)] = op.spec()
+	}
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":   "Task API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": object{
+			"schemas": schemas,
+			"securitySchemes": object{
+				"bearerAuth": object{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"apiKeyAuth": object{"type": "apiKey", "in": "header", "name": middleware.APIKeyHeader},
+			},
+		},
+	}
+}
+
+// spec renders the operation object
+func (op operation) spec() object {
+	responses := object{}
+	success := object{"description": http.StatusText(op.status)}
+	if op.response != nil {
+		contentType := op.contentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		content := object{contentType: object{"schema": schemaFor(reflect.TypeOf(op.response))}}
+		for mediaType, body := range op.altContent {
+			content[mediaType] = object{"schema": schemaFor(reflect.TypeOf(body))}
+		}
+		success["content"] = content
+	}
+	responses[strconv.Itoa(op.status)] = success
+
+	for _, code := range op.errors {
+		schema := schemaRef("ErrorResponse")
+		if body, ok := op.errorBodies[code]; ok {
+			schema = schemaFor(reflect.TypeOf(body))
+		}
+		responses[strconv.Itoa(code)] = object{
+			"description": http.StatusText(code),
+			"content":     object{"application/json": object{"schema": schema}},
+		}
+	}
+
+	spec := object{
+		"tags":      []string{op.tag},
+		"summary":   op.summary,
+		"responses": responses,
+	}
+	if len(op.params) > 0 {
+		spec["parameters"] = op.params
+	}
+	if op.body != nil {
+		spec["requestBody"] = object{
+			"required": true,
+			"content":  object{"application/json": object{"schema": schemaFor(reflect.TypeOf(op.body))}},
+		}
+	}
+	if op.auth {
+		spec["security"] = []object{{"bearerAuth": []string{}}, {"apiKeyAuth": []string{}}}
+	}
+	return spec
+}
+
+func pathParam(name string, description string) object {
+	return object{"name": name, "in": "path", "required": true, "description": description, "schema": object{"type": "string"}}
+}
+
+func queryParam(name string, description string, schema object) object {
+	return object{"name": name, "in": "query", "description": description, "schema": schema}
+}
+
+func headerParam(name string, description string) object {
+	return object{"name": name, "in": "header", "description": description, "schema": object{"type": "string"}}
+}
+
+func schemaRef(name string) object {
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+// isSchemaType reports whether t is published under components/schemas
+func isSchemaType(t reflect.Type) bool {
+	for _, v := range schemaTypes {
+		if reflect.TypeOf(v) == t {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaFor describes a Go type as a JSON schema, referencing published
+// struct types rather than inlining them
+func schemaFor(t reflect.Type) object {
+	nullable := false
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var schema object
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		schema = object{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct && isSchemaType(t):
+		// $ref can't carry siblings such as nullable in OpenAPI 3.0
+		return schemaRef(t.Name())
+	case t.Kind() == reflect.Struct:
+		schema = structSchema(t)
+	case t.Kind() == reflect.String:
+		schema = object{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		schema = object{"type": "boolean"}
+	case t.Kind() == reflect.Int64:
+		schema = object{"type": "integer", "format": "int64"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		schema = object{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		schema = object{"type": "number"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		schema = object{"type": "array", "items": schemaFor(t.Elem())}
+	case t.Kind() == reflect.Map:
+		schema = object{"type": "object", "additionalProperties": schemaFor(t.Elem())}
+	default:
+		schema = object{}
+	}
+
+	if nullable {
+		schema["nullable"] = true
+	}
+	return schema
+}
+
+// structSchema describes a struct from its exported fields' json tags.
+// Embedded structs contribute their fields directly, as in encoding/json.
+func structSchema(t reflect.Type) object {
+	properties := object{}
+	var required []string
+
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				addFields(field.Type)
+				continue
+			}
+
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = schemaFor(field.Type)
+			if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Ptr {
+				required = append(required, name)
+			}
+		}
+	}
+	addFields(t)
+
+	schema := object{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// OpenAPIHandler serves the OpenAPI document and a Swagger UI page for it
+type OpenAPIHandler struct {
+	spec []byte
+}
+
+// NewOpenAPIHandler creates a new OpenAPI handler, rendering the document once
+func NewOpenAPIHandler() *OpenAPIHandler {
+	spec, err := json.Marshal(BuildOpenAPISpec())
+	if err != nil {
+		// The document is built from static values, so this is a programming error
+		panic("handlers: encoding OpenAPI spec: " + err.Error())
+	}
+	return &OpenAPIHandler{spec: spec}
+}
+
+// Spec serves the OpenAPI document
+func (h *OpenAPIHandler) Spec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(h.spec)
+}
+
+// swaggerUIPage loads Swagger UI from a CDN and points it at /openapi.json
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Task API docs</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`
+
+// Docs serves a Swagger UI page for the OpenAPI document
+func (h *OpenAPIHandler) Docs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(swaggerUIPage))
+}
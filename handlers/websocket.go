@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"taskapi/database"
+	"taskapi/middleware"
+	"taskapi/models"
+	"taskapi/services"
+)
+
+// WebSocket connection settings. The server pings every socketPingPeriod and
+// drops a client that hasn't answered within socketPongWait.
+const (
+	socketWriteWait       = 10 * time.Second
+	socketPongWait        = 60 * time.Second
+	socketPingPeriod      = socketPongWait * 9 / 10
+	socketMaxMessageBytes = 4096
+	socketReplyBuffer     = 16
+)
+
+// Message types exchanged over the task WebSocket, besides the task events
+// themselves
+const (
+	SocketTypeUpdateStatus = "task.update_status" // Sent by the client
+	SocketTypeTaskUpdated  = "task.updated"       // Reply to a successful update
+	SocketTypeError        = "error"              // Reply to a rejected message
+)
+
+// SocketStatusUpdate is a message a WebSocket client sends to change one of
+// its tasks' status
+type SocketStatusUpdate struct {
+	Type    string `json:"type"`
+	TaskID  string `json:"task_id"`
+	Status  string `json:"status"`
+	Version int    `json:"version"` // Expected current version, if set
+}
+
+// SocketReply answers a client message with the updated task or an error
+type SocketReply struct {
+	Type   string       `json:"type"`
+	TaskID string       `json:"task_id,omitempty"`
+	Task   *models.Task `json:"task,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// upgrader only accepts same-origin browser connections (its default)
+var upgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+
+// TaskSocket upgrades to a WebSocket that carries the caller's task events,
+// like StreamTasks, and accepts status updates in the other direction
+func (h *TaskHandler) TaskSocket(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already responded with an HTTP error
+		return
+	}
+	defer conn.Close()
+
+	eventsCh, cancel := h.hub.Subscribe(claims.UserID)
+	defer cancel()
+
+	// The reader stops the connection when the client goes away
+	ctx, stop := context.WithCancel(r.Context())
+	defer stop()
+
+	replies := make(chan SocketReply, socketReplyBuffer)
+	go func() {
+		defer stop()
+		h.readSocket(ctx, conn, claims, replies)
+	}()
+
+	ticker := time.NewTicker(socketPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(socketWriteWait))
+			return
+		case <-ticker.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteWait))
+		case event := <-eventsCh:
+			err = writeSocketJSON(conn, event)
+		case reply := <-replies:
+			err = writeSocketJSON(conn, reply)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readSocket handles client messages until the connection fails or ctx ends,
+// queueing a reply to each. The pong handler keeps the read deadline moving
+// while the client answers pings.
+func (h *TaskHandler) readSocket(ctx context.Context, conn *websocket.Conn, claims *middleware.Claims, replies chan<- SocketReply) {
+	conn.SetReadLimit(socketMaxMessageBytes)
+	conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				slog.Warn("Task socket closed unexpectedly", "user_id", claims.UserID, "error", err)
+			}
+			return
+		}
+
+		reply := h.handleSocketMessage(ctx, claims, data)
+		select {
+		case replies <- reply:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleSocketMessage applies one client message through the task service,
+// with the same authorization as PUT /api/tasks/{id}
+func (h *TaskHandler) handleSocketMessage(ctx context.Context, claims *middleware.Claims, data []byte) SocketReply {
+	var msg SocketStatusUpdate
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return SocketReply{Type: SocketTypeError, Error: "Malformed JSON message"}
+	}
+
+	reply := SocketReply{Type: SocketTypeError, TaskID: msg.TaskID}
+	switch {
+	case msg.Type != SocketTypeUpdateStatus:
+		reply.Error = "unsupported message type"
+	case claims.Role == models.RoleViewer:
+		reply.Error = "Viewers have read-only access"
+	case !isUUID(msg.TaskID):
+		reply.Error = "task_id must be a UUID"
+	case msg.Status == "":
+		reply.Error = "status is required"
+	default:
+		req := &models.UpdateTaskRequest{Status: msg.Status, Version: msg.Version}
+		task, err := h.taskService.UpdateTask(ctx, claims.UserID, msg.TaskID, req, claims.Role == models.RoleAdmin)
+		if err != nil {
+			reply.Error = socketErrorMessage(err)
+			return reply
+		}
+		return SocketReply{Type: SocketTypeTaskUpdated, TaskID: task.ID, Task: task}
+	}
+	return reply
+}
+
+// socketErrorMessage is the client-safe message for a service error, the
+// WebSocket counterpart of writeServiceError
+func socketErrorMessage(err error) string {
+	switch {
+	case database.IsConnectionError(err):
+		slog.Error("Database unavailable", "error", err)
+		return "Service temporarily unavailable"
+	case errors.Is(err, services.ErrValidation), errors.Is(err, services.ErrUnauthorized),
+		errors.Is(err, services.ErrForbidden), errors.Is(err, services.ErrNotFound),
+		errors.Is(err, services.ErrConflict), errors.Is(err, services.ErrRateLimited):
+		return err.Error()
+	default:
+		slog.Error("Unhandled service error", "error", err)
+		return "Internal server error"
+	}
+}
+
+// writeSocketJSON sends v as a text message, giving up after socketWriteWait
+func writeSocketJSON(conn *websocket.Conn, v interface{}) error {
+	conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+	return conn.WriteJSON(v)
+}
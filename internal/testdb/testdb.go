@@ -0,0 +1,185 @@
+// Package testdb runs integration tests against a throwaway Postgres started
+// in Docker with testcontainers-go. A package opts in from its TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(testdb.Main(m))
+//	}
+//
+// and each test that needs the database calls New. When Docker isn't
+// available, or tests run with -short, New skips the test instead of
+// failing, so the unit tests in the package still run.
+package testdb
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"taskapi/config"
+	"taskapi/database"
+)
+
+// Image matches the database docker-compose.yml runs
+const Image = "postgres:15-alpine"
+
+var (
+	// db is shared by every test in the package; nil when skipReason is set
+	db         *database.DB
+	cfg        *config.Config
+	skipReason string
+)
+
+// Main starts Postgres, applies the migrations, runs the package's tests and
+// removes the container again. It returns the exit code for os.Exit.
+func Main(m *testing.M) int {
+	// testing.Short needs the flags, which m.Run would otherwise parse
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+	if testing.Short() {
+		skipReason = "integration test skipped in -short mode"
+		return m.Run()
+	}
+
+	ctx := context.Background()
+	container, err := start(ctx)
+	if err != nil {
+		skipReason = fmt.Sprintf("Postgres container unavailable: %v", err)
+		return m.Run()
+	}
+	defer func() {
+		if err := container.Terminate(ctx); err != nil {
+			slog.Error("Failed to remove Postgres container", "error", err)
+		}
+	}()
+
+	if err := connect(ctx, container); err != nil {
+		slog.Error("Failed to prepare test database", "error", err)
+		return 1
+	}
+	defer db.Close()
+
+	return m.Run()
+}
+
+// start runs the Postgres container and waits until it accepts connections.
+// testcontainers panics rather than erroring on some hosts without Docker,
+// so a panic is reported as an error too.
+func start(ctx context.Context) (container *postgres.PostgresContainer, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("docker: %v", r)
+		}
+	}()
+
+	provider, err := testcontainers.NewDockerProvider()
+	if err != nil {
+		return nil, err
+	}
+	defer provider.Close()
+	if err := provider.Health(ctx); err != nil {
+		return nil, err
+	}
+
+	return postgres.RunContainer(ctx,
+		testcontainers.WithImage(Image),
+		postgres.WithDatabase("taskdb"),
+		postgres.WithUsername("postgres"),
+		postgres.WithPassword("postgres"),
+		testcontainers.WithWaitStrategy(
+			// Postgres restarts once after running its init scripts
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(time.Minute),
+		),
+	)
+}
+
+// connect opens the shared DB against container and applies the migrations
+func connect(ctx context.Context, container *postgres.PostgresContainer) error {
+	host, err := container.Host(ctx)
+	if err != nil {
+		return err
+	}
+	port, err := container.MappedPort(ctx, "5432/tcp")
+	if err != nil {
+		return err
+	}
+
+	cfg = &config.Config{
+		DBHost:                host,
+		DBPort:                port.Port(),
+		DBUser:                "postgres",
+		DBPassword:            "postgres",
+		DBName:                "taskdb",
+		DBConnectAttempts:     5,
+		DBConnectDelaySeconds: 1,
+	}
+	if db, err = database.NewDB(cfg); err != nil {
+		return err
+	}
+	return db.RunMigrations()
+}
+
+// New returns the package's database with every table but
+// schema_migrations emptied, or skips t when there is no database. Tests
+// sharing it must not run in parallel.
+func New(t testing.TB) *database.DB {
+	t.Helper()
+	if skipReason != "" {
+		t.Skip(skipReason)
+	}
+	if db == nil {
+		t.Fatal("testdb.New called without testdb.Main in TestMain")
+	}
+
+	if err := truncate(db); err != nil {
+		t.Fatalf("emptying test database: %v", err)
+	}
+	return db
+}
+
+// Config returns the connection settings of the database New returns, for
+// tests that open their own connection
+func Config(t testing.TB) *config.Config {
+	t.Helper()
+	if skipReason != "" {
+		t.Skip(skipReason)
+	}
+	c := *cfg
+	return &c
+}
+
+// truncate empties every table the migrations created
+func truncate(db *database.DB) error {
+	rows, err := db.Conn.Query(`SELECT tablename FROM pg_tables WHERE schemaname = 'public' AND tablename <> 'schema_migrations'`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return err
+		}
+		tables = append(tables, fmt.Sprintf("%q", table))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+
+	_, err = db.Conn.Exec(`TRUNCATE ` + strings.Join(tables, ", ") + ` RESTART IDENTITY CASCADE`)
+	return err
+}
@@ -0,0 +1,49 @@
+package logger
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// Setup installs a JSON slog logger as the default at the given level
+// ("debug", "info", "warn" or "error"; anything else means info). Log
+// timestamps are shown in the named IANA time zone, or UTC if it is unknown.
+// This only affects display; the API always uses UTC.
+func Setup(level string, timezone string) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level: parseLevel(level),
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				a.Value = slog.TimeValue(a.Value.Time().In(location))
+			}
+			return a
+		},
+	})
+	slog.SetDefault(slog.New(handler))
+}
+
+// Fatal logs an error and exits the process
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
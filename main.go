@@ -1,73 +1,207 @@
 package main
 
 import (
-	"log"
+	"flag"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"taskapi/config"
 	"taskapi/database"
+	"taskapi/events"
 	"taskapi/handlers"
+	"taskapi/logger"
 	"taskapi/middleware"
+	"taskapi/repositories"
 	"taskapi/services"
+	"taskapi/webhook"
 	"taskapi/worker"
 )
 
 func main() {
+	migrateDown := flag.Bool("migrate-down", false, "roll back the most recent database migration and exit")
+	flag.Parse()
+
 	// Load configuration
-	cfg := config.LoadConfig()
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logger.Fatal("Failed to load configuration", "error", err)
+	}
+	logger.Setup(cfg.LogLevel, cfg.LogTimezone)
+
+	if err := cfg.Validate(); err != nil {
+		logger.Fatal("Invalid configuration", "error", err)
+	}
 
 	// Connect to database
 	db, err := database.NewDB(cfg)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v\n", err)
+		logger.Fatal("Failed to connect to database", "error", err)
 	}
 	defer db.Close()
 
+	// Roll back only when explicitly requested, then exit without serving
+	if *migrateDown {
+		version, err := db.RollbackMigration()
+		if err != nil {
+			logger.Fatal("Failed to roll back migration", "error", err)
+		}
+		if version == 0 {
+			slog.Info("No migrations to roll back")
+		} else {
+			slog.Info("Rolled back migration", "version", version)
+		}
+		return
+	}
+
 	// Run migrations
 	if err := db.RunMigrations(); err != nil {
-		log.Fatalf("Failed to run migrations: %v\n", err)
+		logger.Fatal("Failed to run migrations", "error", err)
+	}
+	slog.Info("Database migrations completed successfully")
+
+	if err := db.SyncUniqueTaskTitles(cfg.UniqueTaskTitlesPerUser); err != nil {
+		logger.Fatal("Failed to apply unique task titles setting", "error", err)
+	}
+	if err := db.SyncDescriptionLength(cfg.MaxDescriptionLength); err != nil {
+		logger.Fatal("Failed to apply description length limit", "error", err)
+	}
+
+	// Seed the initial admin account if configured
+	seeded, err := db.SeedAdmin(cfg)
+	if err != nil {
+		logger.Fatal("Failed to seed admin user", "error", err)
+	}
+	if seeded {
+		slog.Info("Created initial admin user", "email", cfg.AdminEmail)
+	}
+
+	// Webhook notifier for task completion events (no-op if WEBHOOK_URL is unset)
+	notifier := webhook.NewNotifier(cfg)
+
+	// Initialize repositories and services
+	userRepo := repositories.NewUserRepository(db)
+	taskRepo, err := repositories.NewTaskRepository(db)
+	if err != nil {
+		logger.Fatal("Failed to prepare task queries", "error", err)
 	}
-	log.Println("Database migrations completed successfully")
+	defer taskRepo.Close()
 
-	// Initialize services (use package-level repository functions)
-	userService := services.NewUserService(db, cfg)
-	taskService := services.NewTaskService(db)
+	userService := services.NewUserService(userRepo, cfg)
+	hub := events.NewHub()
+	taskService := services.NewTaskService(taskRepo, userRepo, cfg, notifier, hub)
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(userService)
-	taskHandler := handlers.NewTaskHandler(taskService)
+	authHandler := handlers.NewAuthHandler(userService, cfg)
+	taskHandler := handlers.NewTaskHandler(taskService, hub, cfg)
+	userHandler := handlers.NewUserHandler(userService)
+	healthHandler := handlers.NewHealthHandler(db)
 
 	// Start background worker
-	taskWorker := worker.NewTaskWorker(db, cfg)
+	taskWorker := worker.NewTaskWorker(taskRepo, cfg, notifier, hub)
 	taskWorker.Start()
+	workerHandler := handlers.NewWorkerHandler(taskWorker, taskService)
 
 	// Setup routes
 	router := mux.NewRouter()
-
-	// Auth routes (no authentication required)
-	router.HandleFunc("/api/auth/register", authHandler.Register).Methods("POST")
-	router.HandleFunc("/api/auth/login", authHandler.Login).Methods("POST")
+	router.Use(middleware.LoggingMiddleware)
+	router.Use(middleware.MetricsMiddleware)
+	router.Use(middleware.BodyLimitMiddleware(cfg))
+
+	// Auth routes (no authentication required, rate limited per client IP)
+	authRouter := router.PathPrefix("/api/auth").Subrouter()
+	authRouter.Use(middleware.RateLimitMiddleware(cfg))
+
+	authRouter.HandleFunc("/register", authHandler.Register).Methods("POST")
+	authRouter.HandleFunc("/login", authHandler.Login).Methods("POST")
+	authRouter.HandleFunc("/logout", authHandler.Logout).Methods("POST")
+	authRouter.HandleFunc("/forgot-password", authHandler.ForgotPassword).Methods("POST")
+	authRouter.HandleFunc("/reset-password", authHandler.ResetPassword).Methods("POST")
+	authRouter.HandleFunc("/verify", authHandler.VerifyEmail).Methods("GET")
+
+	// Account routes for the authenticated caller (still rate limited)
+	accountRouter := authRouter.PathPrefix("/me").Subrouter()
+	accountRouter.Use(middleware.AuthMiddleware(cfg, userService))
+	accountRouter.Use(middleware.RejectImpersonatedChanges())
+
+	accountRouter.HandleFunc("", authHandler.Me).Methods("GET")
+	accountRouter.HandleFunc("", authHandler.UpdateProfile).Methods("PATCH")
+	accountRouter.HandleFunc("", authHandler.DeleteAccount).Methods("DELETE")
+	accountRouter.HandleFunc("/verification", authHandler.ResendVerification).Methods("POST")
+	accountRouter.HandleFunc("/api-keys", authHandler.CreateAPIKey).Methods("POST")
+	accountRouter.HandleFunc("/api-keys", authHandler.ListAPIKeys).Methods("GET")
+	accountRouter.HandleFunc("/api-keys/{id}", authHandler.RevokeAPIKey).Methods("DELETE")
+
+	// Task WebSocket. Registered before the other task routes so /{id} doesn't
+	// match it; browsers can't set headers here, so the token may be in the URL.
+	socketRouter := router.Path("/api/tasks/ws").Subrouter()
+	socketRouter.Use(middleware.TokenFromQuery)
+	socketRouter.Use(middleware.AuthMiddleware(cfg, userService))
+	socketRouter.Use(middleware.RequireVerifiedEmail(cfg, userService))
+
+	socketRouter.Methods("GET").HandlerFunc(taskHandler.TaskSocket)
 
 	// Protected task routes
 	protectedRouter := router.PathPrefix("/api/tasks").Subrouter()
-	protectedRouter.Use(middleware.AuthMiddleware(cfg))
+	protectedRouter.Use(middleware.AuthMiddleware(cfg, userService))
+	protectedRouter.Use(middleware.RequireVerifiedEmail(cfg, userService))
+	protectedRouter.Use(middleware.RequireWriteAccess())
 
 	protectedRouter.HandleFunc("", taskHandler.CreateTask).Methods("POST")
 	protectedRouter.HandleFunc("", taskHandler.GetTasks).Methods("GET")
+	protectedRouter.HandleFunc("/stats", taskHandler.GetTaskStats).Methods("GET")
+	protectedRouter.HandleFunc("/board", taskHandler.GetTaskBoard).Methods("GET")
+	protectedRouter.HandleFunc("/upcoming", taskHandler.GetUpcomingTasks).Methods("GET")
+	protectedRouter.HandleFunc("/stream", taskHandler.StreamTasks).Methods("GET")
+	protectedRouter.HandleFunc("/bulk", taskHandler.CreateTasks).Methods("POST")
+	protectedRouter.HandleFunc("/bulk-delete", taskHandler.DeleteTasks).Methods("POST")
+	protectedRouter.HandleFunc("/status", taskHandler.UpdateTasksStatus).Methods("PATCH")
 	protectedRouter.HandleFunc("/{id}", taskHandler.GetTask).Methods("GET")
 	protectedRouter.HandleFunc("/{id}", taskHandler.UpdateTask).Methods("PUT")
 	protectedRouter.HandleFunc("/{id}", taskHandler.DeleteTask).Methods("DELETE")
-
-	// Health check endpoint
-	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status": "ok"}`))
-	}).Methods("GET")
+	protectedRouter.HandleFunc("/{id}/restore", taskHandler.RestoreTask).Methods("POST")
+	protectedRouter.HandleFunc("/{id}/archive", taskHandler.ArchiveTask).Methods("POST")
+	protectedRouter.HandleFunc("/{id}/unarchive", taskHandler.UnarchiveTask).Methods("POST")
+	protectedRouter.HandleFunc("/{id}/history", taskHandler.GetTaskHistory).Methods("GET")
+
+	// Admin-only routes
+	adminRouter := router.PathPrefix("/api/admin").Subrouter()
+	adminRouter.Use(middleware.AuthMiddleware(cfg, userService))
+	adminRouter.Use(middleware.RequireRole("admin"))
+	adminRouter.Use(middleware.RejectImpersonation())
+
+	adminRouter.HandleFunc("/tasks", taskHandler.GetAllTasks).Methods("GET")
+	adminRouter.HandleFunc("/tasks/purge", workerHandler.PurgeCompletedTasks).Methods("POST")
+	adminRouter.HandleFunc("/stats/daily", taskHandler.GetDailyStats).Methods("GET")
+	adminRouter.HandleFunc("/tasks/{id}/complete", taskHandler.ForceCompleteTask).Methods("POST")
+	adminRouter.HandleFunc("/tasks/{id}/reopen", taskHandler.ReopenTask).Methods("POST")
+	adminRouter.HandleFunc("/tasks/{id}/submit", workerHandler.SubmitTask).Methods("POST")
+	adminRouter.HandleFunc("/worker", workerHandler.Status).Methods("GET")
+	adminRouter.HandleFunc("/migrations", healthHandler.Migrations).Methods("GET")
+	adminRouter.HandleFunc("/auto-complete/preview", workerHandler.PreviewAutoCompletion).Methods("GET")
+	adminRouter.HandleFunc("/users", userHandler.ListUsers).Methods("GET")
+	adminRouter.HandleFunc("/users/{id}", userHandler.GetUser).Methods("GET")
+	adminRouter.HandleFunc("/users/{id}", userHandler.DeleteUser).Methods("DELETE")
+	adminRouter.HandleFunc("/users/{id}/role", userHandler.UpdateUserRole).Methods("PUT")
+	adminRouter.HandleFunc("/users/{id}/transfer-tasks", taskHandler.TransferTasks).Methods("POST")
+	adminRouter.HandleFunc("/users/{id}/impersonate", userHandler.Impersonate).Methods("POST")
+
+	// Health check endpoints
+	router.HandleFunc("/health", healthHandler.Health).Methods("GET")
+	router.HandleFunc("/live", healthHandler.Live).Methods("GET")
+	router.HandleFunc("/ready", healthHandler.Ready).Methods("GET")
+
+	// Prometheus metrics endpoint
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+
+	// API documentation (keep handlers.operations in step with the routes above)
+	openAPIHandler := handlers.NewOpenAPIHandler()
+	router.HandleFunc("/openapi.json", openAPIHandler.Spec).Methods("GET")
+	router.HandleFunc("/docs", openAPIHandler.Docs).Methods("GET")
 
 	// Setup graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -75,16 +209,28 @@ func main() {
 
 	go func() {
 		<-sigChan
-		log.Println("\nShutting down server...")
-		taskWorker.Stop()
+		slog.Info("Shutting down server")
+		if err := taskWorker.Stop(); err != nil {
+			// Exit anyway rather than hang on a stuck goroutine
+			os.Exit(1)
+		}
 		os.Exit(0)
 	}()
 
-	// Start server
-	log.Printf("Server starting on port %s\n", cfg.ServerPort)
-	log.Printf("Auto-complete delay: %d minutes\n", cfg.AutoCompleteMinutes)
+	// Start server (HTTPS when a certificate and key are configured)
+	srv := &http.Server{
+		Addr:    ":" + cfg.ServerPort,
+		Handler: router,
+	}
+
+	slog.Info("Server starting", "port", cfg.ServerPort, "tls", cfg.TLSEnabled(), "auto_complete_minutes", cfg.AutoCompleteMinutes)
 
-	if err := http.ListenAndServe(":"+cfg.ServerPort, router); err != nil {
-		log.Fatalf("Server error: %v\n", err)
+	if cfg.TLSEnabled() {
+		err = srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil {
+		logger.Fatal("Server error", "error", err)
 	}
 }
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// HTTPRequestsTotal counts HTTP requests by method, route template and status
+	HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "taskapi_http_requests_total",
+		Help: "Total number of HTTP requests.",
+	}, []string{"method", "path", "status"})
+
+	// HTTPRequestDuration observes request latency by method and route template
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "taskapi_http_request_duration_seconds",
+		Help:    "HTTP request latency in seconds.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "path"})
+
+	// TasksCreatedTotal counts tasks created through the API
+	TasksCreatedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "taskapi_tasks_created_total",
+		Help: "Total number of tasks created.",
+	})
+
+	// TasksCompletedTotal counts tasks transitioned to completed, by source
+	// ("user" or "worker")
+	TasksCompletedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "taskapi_tasks_completed_total",
+		Help: "Total number of tasks marked completed.",
+	}, []string{"source"})
+
+	// WorkerAutoCompletionsTotal counts auto-completion attempts by result
+	// ("success" or "failure")
+	WorkerAutoCompletionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "taskapi_worker_auto_completions_total",
+		Help: "Total number of worker auto-completion attempts.",
+	}, []string{"result"})
+)
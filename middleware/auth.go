@@ -3,55 +3,160 @@ package middleware
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"taskapi/config"
+	"taskapi/database"
 	"taskapi/models"
 )
 
 const (
 	AuthContextKey = "user"
 	BearerScheme   = "Bearer"
+	APIKeyHeader   = "X-API-Key"
+
+	// RefreshedTokenHeader carries a renewed token when sliding sessions are enabled
+	RefreshedTokenHeader = "X-Refreshed-Token"
+
+	// AuthCookieName is the httpOnly cookie holding the token when AUTH_COOKIE is enabled
+	AuthCookieName = "auth_token"
 )
 
+// APIKeyResolver looks up the user that owns an API key
+type APIKeyResolver interface {
+	ResolveAPIKey(ctx context.Context, key string) (*models.User, error)
+}
+
+// EmailVerificationChecker reports whether a user has verified their email
+type EmailVerificationChecker interface {
+	IsEmailVerified(ctx context.Context, userID string) (bool, error)
+}
+
+// ErrTokenExpired is returned by ValidateToken for a well-formed, correctly
+// signed token that has expired
+var ErrTokenExpired = errors.New("token has expired")
+
+// Machine-readable codes for 401 responses to bearer tokens
+const (
+	CodeTokenExpired = "token_expired"
+	CodeTokenInvalid = "token_invalid"
+)
+
+// CodeEmailNotVerified marks 403 responses to users who must verify their email
+const CodeEmailNotVerified = "email_not_verified"
+
+// CodeReadOnly marks 403 responses to viewers attempting to change data
+const CodeReadOnly = "read_only"
+
+// CodeImpersonating marks 403 responses to impersonation tokens attempting
+// to change the impersonated account
+const CodeImpersonating = "impersonating"
+
 // Claims represents JWT claims
 type Claims struct {
 	UserID   string `json:"user_id"`
 	Email    string `json:"email"`
 	Username string `json:"username"`
 	Role     string `json:"role"`
+	// ImpersonatedBy is the ID of the admin an impersonation token was
+	// issued to; empty for the user's own tokens
+	ImpersonatedBy string `json:"impersonated_by,omitempty"`
 	jwt.RegisteredClaims
 }
 
 // GenerateToken generates a JWT token
 func GenerateToken(user *models.User, cfg *config.Config) (string, error) {
-	expirationTime := time.Now().Add(time.Duration(cfg.JWTExpiryHours) * time.Hour)
+	return signToken(newClaims(user, time.Duration(cfg.JWTExpiryHours)*time.Hour, cfg), cfg)
+}
+
+// GenerateImpersonationToken generates a token that lets the admin adminID
+// act as user. It lasts IMPERSONATION_TOKEN_MINUTES whatever JWT_EXPIRY_HOURS
+// is, and is never renewed.
+func GenerateImpersonationToken(user *models.User, adminID string, cfg *config.Config) (string, error) {
+	claims := newClaims(user, time.Duration(cfg.ImpersonationTokenMinutes)*time.Minute, cfg)
+	claims.ImpersonatedBy = adminID
+	return signToken(claims, cfg)
+}
+
+// newClaims returns the claims for a token for user that expires after ttl
+func newClaims(user *models.User, ttl time.Duration, cfg *config.Config) *Claims {
+	now := time.Now()
 	claims := &Claims{
 		UserID:   user.ID,
 		Email:    user.Email,
 		Username: user.Username,
 		Role:     user.Role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    cfg.JWTIssuer,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
+	if cfg.JWTAudience != "" {
+		claims.Audience = jwt.ClaimStrings{cfg.JWTAudience}
+	}
+	return claims
+}
+
+// signToken signs claims with the configured algorithm
+func signToken(claims *Claims, cfg *config.Config) (string, error) {
+
+	if cfg.JWTAlgorithm == config.JWTAlgorithmRS256 {
+		if cfg.JWTPrivateKey() == nil {
+			return "", errors.New("RS256 private key is not loaded")
+		}
+		return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(cfg.JWTPrivateKey())
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(cfg.JWTSecret))
 }
 
-// ValidateToken validates a JWT token and returns claims
+// ValidateToken validates a JWT token and returns claims. Only tokens whose
+// alg header matches the configured algorithm are accepted, so an RS256
+// public key can never be used as an HMAC secret and "none" is never valid.
+// When JWT_ISSUER or JWT_AUDIENCE is set, the token must carry that issuer
+// or audience.
 func ValidateToken(tokenString string, cfg *config.Config) (*Claims, error) {
+	options := []jwt.ParserOption{jwt.WithValidMethods([]string{cfg.JWTAlgorithm})}
+	if cfg.JWTIssuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.JWTIssuer))
+	}
+	if cfg.JWTAudience != "" {
+		options = append(options, jwt.WithAudience(cfg.JWTAudience))
+	}
+
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		// Check the method type here as well as via WithValidMethods, so the
+		// key is never handed to an unexpected verifier
+		if cfg.JWTAlgorithm == config.JWTAlgorithmRS256 {
+			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+			}
+			if cfg.JWTPublicKey() == nil {
+				return nil, errors.New("RS256 public key is not loaded")
+			}
+			return cfg.JWTPublicKey(), nil
+		}
+
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
 		return []byte(cfg.JWTSecret), nil
-	})
+	}, options...)
 
 	if err != nil {
+		// Parse only reports expiry once the signature has been verified
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrTokenExpired
+		}
 		return nil, err
 	}
 
@@ -62,11 +167,45 @@ func ValidateToken(tokenString string, cfg *config.Config) (*Claims, error) {
 	return claims, nil
 }
 
-// AuthMiddleware is a middleware that checks for valid JWT token
-func AuthMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+// AuthMiddleware is a middleware that checks for a valid JWT token or, when
+// apiKeys is non-nil, an X-API-Key header. An API key authenticates the
+// request as its owner with the owner's current role.
+func AuthMiddleware(cfg *config.Config, apiKeys APIKeyResolver) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key := r.Header.Get(APIKeyHeader); key != "" && apiKeys != nil {
+				user, err := apiKeys.ResolveAPIKey(r.Context(), key)
+				if database.IsConnectionError(err) {
+					writeDatabaseUnavailable(w, r, err)
+					return
+				}
+				if err != nil {
+					writeError(w, http.StatusUnauthorized, "Invalid API key")
+					return
+				}
+
+				claims := &Claims{
+					UserID:   user.ID,
+					Email:    user.Email,
+					Username: user.Username,
+					Role:     user.Role,
+				}
+				setRequestUser(r, claims.UserID)
+
+				ctx := context.WithValue(r.Context(), AuthContextKey, claims)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			// The header wins; the cookie is only a fallback for browsers
 			authHeader := r.Header.Get("Authorization")
+			fromCookie := false
+			if authHeader == "" && cfg.AuthCookie {
+				if cookie, err := r.Cookie(AuthCookieName); err == nil && cookie.Value != "" {
+					authHeader = BearerScheme + " " + cookie.Value
+					fromCookie = true
+				}
+			}
 			if authHeader == "" {
 				writeError(w, http.StatusUnauthorized, "Missing authorization header")
 				return
@@ -79,17 +218,237 @@ func AuthMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
 			}
 
 			claims, err := ValidateToken(parts[1], cfg)
+			if errors.Is(err, ErrTokenExpired) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="The token has expired"`)
+				writeCodedError(w, http.StatusUnauthorized, CodeTokenExpired, "Token has expired")
+				return
+			}
 			if err != nil {
-				writeError(w, http.StatusUnauthorized, "Invalid token")
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				writeCodedError(w, http.StatusUnauthorized, CodeTokenInvalid, "Invalid token")
 				return
 			}
 
+			setRequestUser(r, claims.UserID)
+			setRequestImpersonator(r, claims.ImpersonatedBy)
+			renewToken(w, claims, cfg, fromCookie)
+
 			ctx := context.WithValue(r.Context(), AuthContextKey, claims)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// renewToken sets X-Refreshed-Token to a fresh token when sliding sessions
+// are enabled and a valid token expires within TOKEN_RENEWAL_MINUTES, and
+// replaces the auth cookie too when that is where the token came from. The
+// claims must already have passed ValidateToken, so expired tokens are never
+// renewed, and neither are impersonation tokens.
+func renewToken(w http.ResponseWriter, claims *Claims, cfg *config.Config, fromCookie bool) {
+	if !cfg.TokenRenewalEnabled || claims.ExpiresAt == nil || claims.ImpersonatedBy != "" {
+		return
+	}
+	if time.Until(claims.ExpiresAt.Time) > time.Duration(cfg.TokenRenewalMinutes)*time.Minute {
+		return
+	}
+
+	token, err := GenerateToken(&models.User{
+		ID:       claims.UserID,
+		Email:    claims.Email,
+		Username: claims.Username,
+		Role:     claims.Role,
+	}, cfg)
+	if err != nil {
+		slog.Error("Failed to renew token", "user_id", claims.UserID, "error", err)
+		return
+	}
+	w.Header().Set(RefreshedTokenHeader, token)
+	if fromCookie {
+		SetAuthCookie(w, token, cfg)
+	}
+}
+
+// SetAuthCookie stores token in an httpOnly, Secure, SameSite=Strict cookie
+// that expires along with it. It does nothing unless AUTH_COOKIE is enabled.
+func SetAuthCookie(w http.ResponseWriter, token string, cfg *config.Config) {
+	if !cfg.AuthCookie {
+		return
+	}
+	http.SetCookie(w, authCookie(token, cfg.JWTExpiryHours*3600))
+}
+
+// ClearAuthCookie tells the browser to delete the auth cookie
+func ClearAuthCookie(w http.ResponseWriter) {
+	http.SetCookie(w, authCookie("", -1))
+}
+
+// authCookie builds the auth cookie. SameSite=Strict keeps browsers from
+// sending it with cross-site requests, which would otherwise allow CSRF.
+func authCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     AuthCookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// RequireRole is a middleware that only allows users with the given role.
+// It must be applied after AuthMiddleware so claims are in the context.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := GetUserFromContext(r)
+			if claims == nil {
+				writeError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			if claims.Role != role {
+				writeError(w, http.StatusForbidden, "Insufficient permissions")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TokenQueryParam carries a JWT for clients, such as browser WebSockets, that
+// cannot set the Authorization header
+const TokenQueryParam = "access_token"
+
+// TokenFromQuery is a middleware that moves a JWT from the access_token query
+// parameter into the Authorization header when the request has none. Apply
+// it before AuthMiddleware, and only on routes that need it.
+func TokenFromQuery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if token := query.Get(TokenQueryParam); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", BearerScheme+" "+token)
+			// Keep the token out of anything that records the URL later
+			query.Del(TokenQueryParam)
+			r.URL.RawQuery = query.Encode()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireWriteAccess is a middleware that lets viewers make only read
+// requests (GET, HEAD and OPTIONS). It must be applied after AuthMiddleware.
+func RequireWriteAccess() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := GetUserFromContext(r)
+			if claims == nil {
+				writeError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+			default:
+				if claims.Role == models.RoleViewer {
+					writeCodedError(w, http.StatusForbidden, CodeReadOnly, "Viewers have read-only access")
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RejectImpersonatedChanges is a middleware that lets impersonation tokens
+// make only read requests, so an admin acting as a user can't change the
+// account's credentials or mint longer-lived ones. It must be applied after
+// AuthMiddleware.
+func RejectImpersonatedChanges() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := GetUserFromContext(r)
+			if claims == nil {
+				writeError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+			default:
+				if claims.ImpersonatedBy != "" {
+					writeCodedError(w, http.StatusForbidden, CodeImpersonating, "Account changes are not allowed while impersonating")
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RejectImpersonation is a middleware that refuses impersonation tokens
+// outright. Impersonated users are never admins, so on the admin routes it
+// is a second line of defence. It must be applied after AuthMiddleware.
+func RejectImpersonation() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := GetUserFromContext(r)
+			if claims == nil {
+				writeError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			if claims.ImpersonatedBy != "" {
+				writeCodedError(w, http.StatusForbidden, CodeImpersonating, "Not allowed while impersonating")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireVerifiedEmail is a middleware that rejects users who haven't
+// verified their email when REQUIRE_EMAIL_VERIFICATION is set. The flag is
+// read from the database, so tokens issued before verification keep
+// working once the user verifies. It must be applied after AuthMiddleware.
+func RequireVerifiedEmail(cfg *config.Config, checker EmailVerificationChecker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !cfg.RequireEmailVerification {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims := GetUserFromContext(r)
+			if claims == nil {
+				writeError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			verified, err := checker.IsEmailVerified(r.Context(), claims.UserID)
+			if database.IsConnectionError(err) {
+				writeDatabaseUnavailable(w, r, err)
+				return
+			}
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Failed to check email verification", "user_id", claims.UserID, "error", err)
+				writeError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			if !verified {
+				writeCodedError(w, http.StatusForbidden, CodeEmailNotVerified, "Email address is not verified")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // GetUserFromContext retrieves the user claims from context
 func GetUserFromContext(r *http.Request) *Claims {
 	claims := r.Context().Value(AuthContextKey)
@@ -99,14 +458,33 @@ func GetUserFromContext(r *http.Request) *Claims {
 	return claims.(*Claims)
 }
 
-// ErrorResponse is a standard error response
+// ErrorResponse is a standard error response. Code is set for errors clients
+// are expected to handle programmatically.
 type ErrorResponse struct {
 	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
 }
 
 // writeError writes an error response
 func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeCodedError(w, statusCode, "", message)
+}
+
+// DatabaseRetryAfter is the Retry-After value, in seconds, sent with 503s
+// caused by an unreachable database
+const DatabaseRetryAfter = "5"
+
+// writeDatabaseUnavailable logs a lost database connection and writes a
+// retryable 503 that doesn't reveal the cause
+func writeDatabaseUnavailable(w http.ResponseWriter, r *http.Request, err error) {
+	slog.ErrorContext(r.Context(), "Database unavailable", "error", err)
+	w.Header().Set("Retry-After", DatabaseRetryAfter)
+	writeError(w, http.StatusServiceUnavailable, "Service temporarily unavailable")
+}
+
+// writeCodedError writes an error response with a machine-readable code
+func writeCodedError(w http.ResponseWriter, statusCode int, code string, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
+	json.NewEncoder(w).Encode(ErrorResponse{Error: message, Code: code})
 }
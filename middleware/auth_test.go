@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"taskapi/config"
+	"taskapi/models"
+)
+
+func testConfig() *config.Config {
+	return &config.Config{
+		JWTAlgorithm:   config.JWTAlgorithmHS256,
+		JWTSecret:      "test-secret-that-is-at-least-32-chars",
+		JWTExpiryHours: 1,
+	}
+}
+
+func testClaims() *Claims {
+	now := time.Now()
+	return &Claims{
+		UserID:   "11111111-1111-1111-1111-111111111111",
+		Email:    "alice@example.com",
+		Username: "alice",
+		Role:     models.RoleUser,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+}
+
+func TestValidateToken(t *testing.T) {
+	cfg := testConfig()
+
+	token, err := GenerateToken(&models.User{ID: "11111111-1111-1111-1111-111111111111", Role: models.RoleUser}, cfg)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	claims, err := ValidateToken(token, cfg)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if claims.UserID != "11111111-1111-1111-1111-111111111111" {
+		t.Errorf("UserID = %q, want the token's user", claims.UserID)
+	}
+}
+
+func TestValidateTokenRejectsUnexpectedAlgorithms(t *testing.T) {
+	cfg := testConfig()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		sign func(claims *Claims) (string, error)
+	}{
+		{
+			name: "none",
+			sign: func(claims *Claims) (string, error) {
+				return jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+			},
+		},
+		{
+			name: "HS512 with the configured secret",
+			sign: func(claims *Claims) (string, error) {
+				return jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte(cfg.JWTSecret))
+			},
+		},
+		{
+			name: "RS256",
+			sign: func(claims *Claims) (string, error) {
+				return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(rsaKey)
+			},
+		},
+		{
+			name: "HS256 with another secret",
+			sign: func(claims *Claims) (string, error) {
+				return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("some-other-secret-of-32-characters!"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := tt.sign(testClaims())
+			if err != nil {
+				t.Fatalf("signing token: %v", err)
+			}
+			if claims, err := ValidateToken(token, cfg); err == nil {
+				t.Fatalf("ValidateToken accepted the token with claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestValidateTokenExpired(t *testing.T) {
+	cfg := testConfig()
+
+	claims := testClaims()
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(cfg.JWTSecret))
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+
+	if _, err := ValidateToken(token, cfg); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("err = %v, want %v", err, ErrTokenExpired)
+	}
+}
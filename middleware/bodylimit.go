@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"taskapi/config"
+)
+
+// BodyLimitMiddleware caps request bodies at MAX_REQUEST_BYTES. Requests that
+// declare a larger Content-Length are rejected up front; otherwise reads past
+// the limit fail and the handler's decoder reports 413.
+func BodyLimitMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+	maxBytes := cfg.MaxRequestBytes
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body must not exceed %d bytes", maxBytes))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
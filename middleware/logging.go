@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// requestInfoKey is the context key for per-request logging details
+type requestInfoKey struct{}
+
+// requestInfo collects details filled in by later middleware (e.g. the
+// authenticated user) so the request log line can include them
+type requestInfo struct {
+	userID         string
+	impersonatedBy string
+}
+
+// LoggingMiddleware writes a structured log line for every request
+func LoggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{}
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)))
+
+		attrs := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+		}
+		if info.userID != "" {
+			attrs = append(attrs, "user_id", info.userID)
+		}
+		if info.impersonatedBy != "" {
+			attrs = append(attrs, "impersonated_by", info.impersonatedBy)
+		}
+		slog.Info("request", attrs...)
+	})
+}
+
+// setRequestUser records the authenticated user for the request log
+func setRequestUser(r *http.Request, userID string) {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		info.userID = userID
+	}
+}
+
+// setRequestImpersonator records the admin behind an impersonation token for
+// the request log
+func setRequestImpersonator(r *http.Request, adminID string) {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		info.impersonatedBy = adminID
+	}
+}
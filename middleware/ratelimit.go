@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"taskapi/config"
+)
+
+// limiterTTL is how long an idle client limiter is kept before cleanup
+const limiterTTL = 3 * time.Minute
+
+// clientLimiter tracks a token bucket and when it was last used
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimiter holds per-client token buckets keyed by IP
+type RateLimiter struct {
+	mu      sync.Mutex
+	clients map[string]*clientLimiter
+	rps     rate.Limit
+	burst   int
+}
+
+// NewRateLimiter creates a new rate limiter and starts its cleanup goroutine
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	rl := &RateLimiter{
+		clients: make(map[string]*clientLimiter),
+		rps:     rate.Limit(rps),
+		burst:   burst,
+	}
+	go rl.cleanup()
+	return rl
+}
+
+// getLimiter returns the limiter for a client, creating it if needed
+func (rl *RateLimiter) getLimiter(key string) *rate.Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	client, exists := rl.clients[key]
+	if !exists {
+		client = &clientLimiter{limiter: rate.NewLimiter(rl.rps, rl.burst)}
+		rl.clients[key] = client
+	}
+	client.lastSeen = time.Now()
+	return client.limiter
+}
+
+// cleanup periodically removes limiters that have not been used recently
+func (rl *RateLimiter) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		rl.mu.Lock()
+		for key, client := range rl.clients {
+			if time.Since(client.lastSeen) > limiterTTL {
+				delete(rl.clients, key)
+			}
+		}
+		rl.mu.Unlock()
+	}
+}
+
+// Middleware returns a middleware that rejects requests over the limit with 429
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter := rl.getLimiter(clientIP(r))
+
+		reservation := limiter.Reserve()
+		if !reservation.OK() {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusTooManyRequests, "Too many requests")
+			return
+		}
+
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+			retryAfter := int(math.Ceil(delay.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			writeError(w, http.StatusTooManyRequests, "Too many requests")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RateLimitMiddleware creates a rate-limiting middleware from config
+func RateLimitMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+	return NewRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst).Middleware
+}
+
+// clientIP extracts the client IP address from the request.
+// X-Forwarded-For is ignored since clients can spoof it to dodge the limit.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -4,51 +4,383 @@ import "time"
 
 // User represents a user in the system
 type User struct {
-	ID       string `json:"id"`
-	Email    string `json:"email"`
-	Username string `json:"username"`
-	Password string `json:"-"` // Never expose password in JSON
-	Role     string `json:"role"` // "user" or "admin"
-	CreatedAt time.Time `json:"created_at"`
+	ID            string     `json:"id"`
+	Email         string     `json:"email"`
+	Username      string     `json:"username"`
+	Password      string     `json:"-"`    // Never expose password in JSON
+	Role          string     `json:"role"` // One of the Role constants
+	EmailVerified bool       `json:"email_verified"`
+	LastLoginAt   *time.Time `json:"last_login_at"` // Nil until the first password login
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// User roles
+const (
+	RoleUser   = "user"
+	RoleAdmin  = "admin"
+	RoleViewer = "viewer" // May read every task but change none
+)
+
+// ValidRole reports whether role is a known user role
+func ValidRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin || role == RoleViewer
 }
 
 // Task represents a task
 type Task struct {
-	ID        string `json:"id"`
-	UserID    string `json:"-"` // Don't expose in JSON
-	Title     string `json:"title"`
-	Description string `json:"description"`
-	Status    string `json:"status"` // pending, in_progress, completed
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID           string     `json:"id"`
+	UserID       string     `json:"-"` // Don't expose in JSON
+	Title        string     `json:"title"`
+	Description  string     `json:"description"`
+	Status       string     `json:"status"`  // One of Statuses
+	Version      int        `json:"version"` // Incremented on every update
+	Tags         []string   `json:"tags"`
+	DueDate      *time.Time `json:"due_date"`
+	Recurrence   string     `json:"recurrence"`      // none, daily, weekly
+	NextRunAt    *time.Time `json:"next_run_at"`     // When the next occurrence is created, for recurring tasks
+	ArchivedAt   *time.Time `json:"archived_at"`     // Archived tasks are hidden from the default list
+	AutoComplete bool       `json:"auto_complete"`   // Whether the worker may complete the task
+	Owner        *TaskOwner `json:"owner,omitempty"` // Included for admins, or on request for the owner
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// TaskOwner identifies the user a task belongs to
+type TaskOwner struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email,omitempty"` // Only shown to admins
+}
+
+// Task statuses. Adding a status means adding a constant, listing it in
+// Statuses and giving it a row for each actor in statusTransitions; the
+// service, worker and repositories take everything else from here.
+const (
+	StatusPending    = "pending"
+	StatusInProgress = "in_progress"
+	StatusCompleted  = "completed"
+	StatusCancelled  = "cancelled"
+)
+
+// Statuses lists every task status, in the order they are reported
+var Statuses = []string{StatusPending, StatusInProgress, StatusCompleted, StatusCancelled}
+
+// ClosedStatuses are the statuses of tasks that are finished and no longer
+// count towards a user's task quota
+var ClosedStatuses = []string{StatusCompleted, StatusCancelled}
+
+// Actors that can change a task's status
+const (
+	ActorUser   = "user"
+	ActorAdmin  = "admin"
+	ActorSystem = "system" // the background worker
+)
+
+// statusTransitions lists, for each actor, the statuses a task may move to
+// from its current status. Setting a task to the status it already has is
+// always allowed. Edit this table to change the workflow.
+var statusTransitions = map[string]map[string][]string{
+	ActorUser: {
+		StatusPending:    {StatusInProgress, StatusCancelled},
+		StatusInProgress: {StatusPending, StatusCompleted, StatusCancelled},
+		StatusCompleted:  {},
+		StatusCancelled:  {StatusPending},
+	},
+	ActorAdmin: {
+		StatusPending:    {StatusInProgress, StatusCompleted, StatusCancelled},
+		StatusInProgress: {StatusPending, StatusCompleted, StatusCancelled},
+		StatusCompleted:  {StatusPending, StatusInProgress, StatusCancelled},
+		StatusCancelled:  {StatusPending, StatusInProgress, StatusCompleted},
+	},
+	// The worker only completes open tasks; cancelled tasks are never
+	// auto-completed
+	ActorSystem: {
+		StatusPending:    {StatusCompleted},
+		StatusInProgress: {StatusCompleted},
+		StatusCompleted:  {},
+		StatusCancelled:  {},
+	},
+}
+
+// CanTransition reports whether actor may move a task from one status to another
+func CanTransition(actor string, from string, to string) bool {
+	if from == to {
+		return true
+	}
+	for _, allowed := range statusTransitions[actor][from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidStatus reports whether status is a known task status
+func ValidStatus(status string) bool {
+	for _, s := range Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusesLeadingTo returns, in a stable order, the statuses from which
+// actor may move a task to the given status
+func StatusesLeadingTo(actor string, to string) []string {
+	var from []string
+	for _, status := range Statuses {
+		if status != to && CanTransition(actor, status, to) {
+			from = append(from, status)
+		}
+	}
+	return from
+}
+
+// Recurrence rules for tasks
+const (
+	RecurrenceNone   = "none"
+	RecurrenceDaily  = "daily"
+	RecurrenceWeekly = "weekly"
+)
+
+// ValidRecurrence reports whether rule is a known recurrence rule
+func ValidRecurrence(rule string) bool {
+	return rule == RecurrenceNone || rule == RecurrenceDaily || rule == RecurrenceWeekly
+}
+
+// NextOccurrence returns the occurrence after from for a recurrence rule.
+// For RecurrenceNone it returns from unchanged.
+func NextOccurrence(rule string, from time.Time) time.Time {
+	switch rule {
+	case RecurrenceDaily:
+		return from.AddDate(0, 0, 1)
+	case RecurrenceWeekly:
+		return from.AddDate(0, 0, 7)
+	default:
+		return from
+	}
+}
+
+// ChangedBySystem is recorded as the actor for status changes made by the worker
+const ChangedBySystem = "system"
+
+// TaskStatusChange is one entry in a task's status history
+type TaskStatusChange struct {
+	ID        int64     `json:"id"`
+	OldStatus string    `json:"old_status"`
+	NewStatus string    `json:"new_status"`
+	ChangedBy string    `json:"changed_by"` // User ID, or "system" for the worker
+	ChangedAt time.Time `json:"changed_at"`
 }
 
-// CreateTaskRequest is the request body for creating a task
+// DailyTaskCount is the number of tasks created and completed on one UTC day
+type DailyTaskCount struct {
+	Date      string `json:"date"` // YYYY-MM-DD
+	Created   int    `json:"created"`
+	Completed int    `json:"completed"`
+}
+
+// AutoCompletePreview lists the tasks the worker would auto-complete for a
+// given task age, without completing them
+type AutoCompletePreview struct {
+	Minutes int     `json:"minutes"`
+	Count   int     `json:"count"`
+	Tasks   []*Task `json:"tasks"`
+}
+
+// PurgeResult reports how many completed tasks a purge removed
+type PurgeResult struct {
+	OlderThanDays int   `json:"older_than_days"`
+	Purged        int64 `json:"purged"`
+}
+
+// CreateTaskRequest is the request body for creating a task. The validate
+// tags are checked by the services; the title limit matches the
+// VARCHAR(255) column.
 type CreateTaskRequest struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
+	Title        string     `json:"title" validate:"notblank,max=255"`
+	Description  string     `json:"description"` // At most MAX_DESCRIPTION_LENGTH characters
+	Tags         []string   `json:"tags" validate:"max=20,dive,notblank,max=50"`
+	DueDate      *time.Time `json:"due_date"`
+	Recurrence   string     `json:"recurrence" validate:"omitempty,recurrence"` // none (default), daily, weekly
+	AutoComplete *bool      `json:"auto_complete"`                              // Defaults to true; false opts the task out of the worker
+}
+
+// TaskFilter narrows, orders and pages a task list. Nil times mean no
+// bound; an empty Sort means newest first; a zero Limit means the default
+// page size. Cursor continues a newest-first listing after the given task.
+// Archived selects archived tasks instead of unarchived ones.
+type TaskFilter struct {
+	UserID        string // Only tasks owned by this user (admin lists)
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Tag           string
+	Statuses      []string // Tasks with any of these statuses; empty means all
+	Search        string   // Case-insensitive substring of the title or description
+	Archived      bool
+	Sort          string
+	Limit         int
+	Offset        int
+	Cursor        *TaskCursor
+	CountTotal    bool // Also count every matching task, ignoring paging
+	IncludeOwner  bool // Join each task's owner (always done for admin lists)
+}
+
+// UserFilter selects, orders and pages the admin user list
+type UserFilter struct {
+	Search string // Case-insensitive substring of the email or username
+	Sort   string
+	Limit  int
+	Offset int
 }
 
-// UpdateTaskRequest is the request body for updating a task
+// UserPage is one page of the user list
+type UserPage struct {
+	Users  []*User
+	Limit  int // The page size that was applied
+	Offset int // Users skipped before this page
+	Total  int // Every matching user
+}
+
+// TaskPage is one page of a task list
+type TaskPage struct {
+	Tasks   []*Task
+	Limit   int  // The page size that was applied
+	Offset  int  // Tasks skipped before this page
+	HasMore bool // Whether more tasks follow this page
+	Total   int  // Every matching task, only set when the filter asked for it
+}
+
+// TaskBoard groups a user's tasks into one column per status, keyed by
+// status. Every status has a column, even when it is empty.
+type TaskBoard map[string][]*Task
+
+// TaskCursor is the keyset position of a task in a newest-first listing
+type TaskCursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        string    `json:"id"`
+}
+
+// BulkItemError describes a validation failure for one item in a bulk request
+type BulkItemError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// UpdateTaskRequest is the request body for updating a task. Empty fields
+// are left unchanged, so every rule only applies to fields that are sent.
 type UpdateTaskRequest struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Status      string `json:"status"`
+	Title          string     `json:"title" validate:"omitempty,notblank,max=255"`
+	Description    string     `json:"description"` // At most MAX_DESCRIPTION_LENGTH characters
+	Status         string     `json:"status" validate:"omitempty,status"`
+	AssigneeUserID string     `json:"assignee_user_id" validate:"omitempty,uuid"`            // Admin only: reassign the task
+	Version        int        `json:"version" validate:"min=0"`                              // Expected current version, if set
+	Tags           *[]string  `json:"tags" validate:"omitempty,max=20,dive,notblank,max=50"` // Replaces all tags when present; [] clears them
+	DueDate        *time.Time `json:"due_date"`
+	Recurrence     string     `json:"recurrence" validate:"omitempty,recurrence"`
+	AutoComplete   *bool      `json:"auto_complete"` // Leaves the setting unchanged when absent
+}
+
+// BulkDeleteRequest is the request body for deleting several tasks
+type BulkDeleteRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// BulkDeleteResponse reports how many tasks were actually deleted
+type BulkDeleteResponse struct {
+	Requested int   `json:"requested"`
+	Deleted   int64 `json:"deleted"`
+}
+
+// TransferTasksRequest is the request body for moving all of a user's tasks
+// to another user
+type TransferTasksRequest struct {
+	TargetUserID string `json:"target_user_id" validate:"required,uuid"`
+}
+
+// TransferTasksResponse reports how many tasks a transfer moved
+type TransferTasksResponse struct {
+	Transferred int64 `json:"transferred"`
+}
+
+// BulkStatusRequest is the request body for moving several tasks to one status
+type BulkStatusRequest struct {
+	IDs    []string `json:"ids"`
+	Status string   `json:"status"`
+}
+
+// BulkStatusResponse reports how many tasks changed status and which were
+// skipped because they don't exist, belong to someone else or can't make
+// the transition
+type BulkStatusResponse struct {
+	Requested int      `json:"requested"`
+	Updated   int      `json:"updated"`
+	Skipped   []string `json:"skipped"`
 }
 
-// RegisterRequest is the request body for user registration
+// RegisterRequest is the request body for user registration. bcrypt only
+// uses the first 72 bytes of a password, so longer ones are rejected.
 type RegisterRequest struct {
-	Email    string `json:"email"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,email,max=255"`
+	Username string `json:"username" validate:"notblank,max=255,nospace"`
+	Password string `json:"password" validate:"required,min=8,maxbytes=72"`
 }
 
 // LoginRequest is the request body for user login
 type LoginRequest struct {
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// ForgotPasswordRequest starts a password reset
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest completes a password reset with the issued token
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// UpdateProfileRequest is the request body for changing the caller's own
+// email or username. Omitted fields are left unchanged.
+type UpdateProfileRequest struct {
 	Email    string `json:"email"`
+	Username string `json:"username"`
+}
+
+// DeleteAccountRequest confirms account self-deletion with the current password
+type DeleteAccountRequest struct {
 	Password string `json:"password"`
 }
 
+// APIKey is a long-lived credential for a user. The key itself is only
+// returned once, at creation.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Label      string     `json:"label"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// CreateAPIKeyRequest is the request body for creating an API key
+type CreateAPIKeyRequest struct {
+	Label string `json:"label"`
+}
+
+// CreateAPIKeyResponse includes the plaintext key, which can't be retrieved again
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// UpdateUserRoleRequest is the request body for changing a user's role
+type UpdateUserRoleRequest struct {
+	Role string `json:"role"`
+}
+
 // AuthResponse is the response for authentication
 type AuthResponse struct {
 	Token string `json:"token"`
@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"taskapi/internal/testdb"
+	"taskapi/models"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(testdb.Main(m))
+}
+
+func TestCreateTasksBatchReturnsStoredRows(t *testing.T) {
+	db := testdb.New(t)
+	ctx := context.Background()
+
+	user := &models.User{Email: "alice@example.com", Username: "alice", Password: "not-a-real-hash", Role: models.RoleUser}
+	if err := CreateUser(db.Conn, user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	tasks := []*models.Task{
+		{Title: "First", Tags: []string{}, Recurrence: models.RecurrenceNone, AutoComplete: true},
+		{Title: "Second", Tags: []string{"work"}, Recurrence: models.RecurrenceNone},
+		{Title: "Third", Tags: []string{}, Recurrence: models.RecurrenceNone, AutoComplete: true},
+	}
+	repo, err := NewTaskRepository(db)
+	if err != nil {
+		t.Fatalf("NewTaskRepository: %v", err)
+	}
+	defer repo.Close()
+
+	if err := repo.CreateTasksBatch(ctx, user.ID, tasks); err != nil {
+		t.Fatalf("CreateTasksBatch: %v", err)
+	}
+
+	for i, task := range tasks {
+		if task.ID == "" {
+			t.Fatalf("task %d has no ID", i)
+		}
+		if task.CreatedAt.IsZero() || task.UpdatedAt.IsZero() {
+			t.Errorf("task %d timestamps not populated: created_at %v, updated_at %v", i, task.CreatedAt, task.UpdatedAt)
+		}
+		if task.UpdatedAt.Before(task.CreatedAt) {
+			t.Errorf("task %d updated_at %v is before created_at %v", i, task.UpdatedAt, task.CreatedAt)
+		}
+		if i > 0 && task.CreatedAt.Before(tasks[i-1].CreatedAt) {
+			t.Errorf("task %d created_at %v is before task %d's %v", i, task.CreatedAt, i-1, tasks[i-1].CreatedAt)
+		}
+
+		// The returned values must be what was stored
+		stored, err := repo.GetTaskByID(task.ID)
+		if err != nil {
+			t.Fatalf("GetTaskByID: %v", err)
+		}
+		if stored.Title != task.Title {
+			t.Errorf("task %d is %q in the database, want %q", i, stored.Title, task.Title)
+		}
+		if !stored.CreatedAt.Equal(task.CreatedAt) || !stored.UpdatedAt.Equal(task.UpdatedAt) {
+			t.Errorf("task %d timestamps = %v/%v, stored %v/%v", i, task.CreatedAt, task.UpdatedAt, stored.CreatedAt, stored.UpdatedAt)
+		}
+		if stored.Version != task.Version {
+			t.Errorf("task %d version = %d, stored %d", i, task.Version, stored.Version)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"taskapi/database"
+	"taskapi/models"
+)
+
+// UserRepository describes user data access so services can be tested
+// without a database
+type UserRepository interface {
+	CreateUser(user *models.User) error
+	GetUserByEmail(email string) (*models.User, error)
+	GetUserByID(id string) (*models.User, error)
+	GetUsers(ctx context.Context, filter models.UserFilter) ([]*models.User, error)
+	CountUsers(ctx context.Context, filter models.UserFilter) (int, error)
+	DeleteUser(id string) error
+	UpdateUserRole(id string, role string) error
+	TouchLastLogin(id string) error
+	UpdateUserProfile(id string, email string, username string) (*models.User, error)
+	CountAdmins() (int, error)
+	LockAdmins() error
+	UpdateUserPassword(id string, passwordHash string) error
+	CreatePasswordReset(userID string, tokenHash string, expiresAt time.Time) error
+	ConsumePasswordReset(tokenHash string) (string, error)
+	InvalidatePasswordResets(userID string) error
+	CreateEmailVerification(userID string, tokenHash string, expiresAt time.Time) error
+	ConsumeEmailVerification(tokenHash string) (string, error)
+	InvalidateEmailVerifications(userID string) error
+	MarkEmailVerified(userID string) error
+	CreateAPIKey(userID string, keyHash string, apiKey *models.APIKey) error
+	GetUserAPIKeys(userID string) ([]*models.APIKey, error)
+	DeleteAPIKey(id string, userID string) error
+	GetUserByAPIKey(keyHash string) (*models.User, error)
+	WithTx(ctx context.Context, fn func(users UserRepository) error) error
+}
+
+// TaskRepository describes task data access so services and the worker can
+// be tested without a database
+type TaskRepository interface {
+	CreateTask(task *models.Task) error
+	CreateTasksBatch(ctx context.Context, userID string, tasks []*models.Task) error
+	ClaimIdempotencyKey(ctx context.Context, userID string, key string, ttlHours int) (string, bool, error)
+	SetIdempotencyKeyTask(ctx context.Context, userID string, key string, taskID string) error
+	CountActiveTasksLocked(ctx context.Context, userID string) (int, error)
+	GetTaskByID(taskID string) (*models.Task, error)
+	GetTaskWithOwner(taskID string) (*models.Task, error)
+	GetTaskByIDForUpdate(taskID string) (*models.Task, error)
+	GetUserTasks(userID string, filter models.TaskFilter) ([]*models.Task, error)
+	GetAllTasks(filter models.TaskFilter) ([]*models.Task, error)
+	CountUserTasks(userID string, filter models.TaskFilter) (int, error)
+	CountAllTasks(filter models.TaskFilter) (int, error)
+	UpdateTask(task *models.Task) error
+	ReassignTask(taskID string, userID string) error
+	TransferTasks(ctx context.Context, fromUserID string, toUserID string) (int64, error)
+	DeleteTask(taskID string) error
+	HardDeleteTask(taskID string) error
+	RestoreTask(taskID string, userID string, isAdmin bool) (*models.Task, error)
+	SetTaskArchived(taskID string, archived bool) (*models.Task, error)
+	DeleteTasks(ctx context.Context, ids []string, userID string, isAdmin bool) (int64, error)
+	CountTasksByStatus(ctx context.Context, userID string, isAdmin bool) (map[string]int, error)
+	GetTaskBoard(ctx context.Context, userID string, perColumn int) ([]*models.Task, error)
+	GetUpcomingTasks(ctx context.Context, userID string, before time.Time, limit int) ([]*models.Task, error)
+	CountTasksByDay(ctx context.Context, from time.Time, to time.Time) ([]models.DailyTaskCount, error)
+	AutoCompleteDueTasks(ctx context.Context, minutes int) ([]AutoCompletedTask, error)
+	GetTasksForAutoCompletion(ctx context.Context, minutes int) ([]*models.Task, error)
+	PurgeCompletedTasks(ctx context.Context, days int) (int64, error)
+	AutoCompleteTask(taskID string) (bool, error)
+	GetRecurringTasksDue() ([]*models.Task, error)
+	RecordStatusChange(taskID string, oldStatus string, newStatus string, changedBy string) error
+	GetTaskStatusHistory(taskID string) ([]*models.TaskStatusChange, error)
+	ClearTaskNextRun(taskID string) error
+	WithTx(ctx context.Context, fn func(tasks TaskRepository) error) error
+	WithRetryTx(ctx context.Context, fn func(tasks TaskRepository) error) error
+}
+
+var (
+	_ UserRepository = (*PostgresUserRepository)(nil)
+	_ TaskRepository = (*PostgresTaskRepository)(nil)
+)
+
+// PostgresUserRepository handles user database operations. Queries run on q,
+// which is the connection pool or, inside WithTx, the transaction.
+type PostgresUserRepository struct {
+	db *database.DB
+	q  database.Querier
+}
+
+// NewUserRepository creates a new user repository
+func NewUserRepository(db *database.DB) *PostgresUserRepository {
+	return &PostgresUserRepository{db: db, q: db.Conn}
+}
+
+// WithTx runs fn with a repository bound to a single transaction
+func (r *PostgresUserRepository) WithTx(ctx context.Context, fn func(users UserRepository) error) error {
+	return r.db.WithTx(ctx, func(tx *sql.Tx) error {
+		return fn(&PostgresUserRepository{db: r.db, q: tx})
+	})
+}
+
+func (r *PostgresUserRepository) CreateUser(user *models.User) error {
+	return CreateUser(r.q, user)
+}
+
+func (r *PostgresUserRepository) GetUserByEmail(email string) (*models.User, error) {
+	return GetUserByEmail(r.q, email)
+}
+
+func (r *PostgresUserRepository) GetUserByID(id string) (*models.User, error) {
+	return GetUserByID(r.q, id)
+}
+
+func (r *PostgresUserRepository) GetUsers(ctx context.Context, filter models.UserFilter) ([]*models.User, error) {
+	return GetUsers(ctx, r.q, filter)
+}
+
+func (r *PostgresUserRepository) CountUsers(ctx context.Context, filter models.UserFilter) (int, error) {
+	return CountUsers(ctx, r.q, filter)
+}
+
+func (r *PostgresUserRepository) DeleteUser(id string) error {
+	return DeleteUser(r.q, id)
+}
+
+func (r *PostgresUserRepository) UpdateUserProfile(id string, email string, username string) (*models.User, error) {
+	return UpdateUserProfile(r.q, id, email, username)
+}
+
+func (r *PostgresUserRepository) UpdateUserRole(id string, role string) error {
+	return UpdateUserRole(r.q, id, role)
+}
+
+func (r *PostgresUserRepository) TouchLastLogin(id string) error {
+	return TouchLastLogin(r.q, id)
+}
+
+func (r *PostgresUserRepository) CountAdmins() (int, error) {
+	return CountAdmins(r.q)
+}
+
+func (r *PostgresUserRepository) LockAdmins() error {
+	return LockAdmins(r.q)
+}
+
+func (r *PostgresUserRepository) UpdateUserPassword(id string, passwordHash string) error {
+	return UpdateUserPassword(r.q, id, passwordHash)
+}
+
+func (r *PostgresUserRepository) CreatePasswordReset(userID string, tokenHash string, expiresAt time.Time) error {
+	return CreatePasswordReset(r.q, userID, tokenHash, expiresAt)
+}
+
+func (r *PostgresUserRepository) ConsumePasswordReset(tokenHash string) (string, error) {
+	return ConsumePasswordReset(r.q, tokenHash)
+}
+
+func (r *PostgresUserRepository) InvalidatePasswordResets(userID string) error {
+	return InvalidatePasswordResets(r.q, userID)
+}
+
+func (r *PostgresUserRepository) CreateEmailVerification(userID string, tokenHash string, expiresAt time.Time) error {
+	return CreateEmailVerification(r.q, userID, tokenHash, expiresAt)
+}
+
+func (r *PostgresUserRepository) ConsumeEmailVerification(tokenHash string) (string, error) {
+	return ConsumeEmailVerification(r.q, tokenHash)
+}
+
+func (r *PostgresUserRepository) InvalidateEmailVerifications(userID string) error {
+	return InvalidateEmailVerifications(r.q, userID)
+}
+
+func (r *PostgresUserRepository) MarkEmailVerified(userID string) error {
+	return MarkEmailVerified(r.q, userID)
+}
+
+func (r *PostgresUserRepository) CreateAPIKey(userID string, keyHash string, apiKey *models.APIKey) error {
+	return CreateAPIKey(r.q, userID, keyHash, apiKey)
+}
+
+func (r *PostgresUserRepository) GetUserAPIKeys(userID string) ([]*models.APIKey, error) {
+	return GetUserAPIKeys(r.q, userID)
+}
+
+func (r *PostgresUserRepository) DeleteAPIKey(id string, userID string) error {
+	return DeleteAPIKey(r.q, id, userID)
+}
+
+func (r *PostgresUserRepository) GetUserByAPIKey(keyHash string) (*models.User, error) {
+	return GetUserByAPIKey(r.q, keyHash)
+}
+
+// PostgresTaskRepository handles task database operations. Queries run on q,
+// which is the connection pool or, inside WithTx, the transaction. The
+// hottest queries use the prepared statements in stmts (see prepared.go).
+type PostgresTaskRepository struct {
+	db    *database.DB
+	q     database.Querier
+	stmts *taskStatements
+}
+
+// NewTaskRepository creates a new task repository and prepares its
+// statements. Close releases them.
+func NewTaskRepository(db *database.DB) (*PostgresTaskRepository, error) {
+	stmts, err := prepareTaskStatements(db.Conn)
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresTaskRepository{db: db, q: db.Conn, stmts: stmts}, nil
+}
+
+// Close closes the repository's prepared statements
+func (r *PostgresTaskRepository) Close() error {
+	return r.stmts.Close()
+}
+
+// WithTx runs fn with a repository bound to a single transaction
+func (r *PostgresTaskRepository) WithTx(ctx context.Context, fn func(tasks TaskRepository) error) error {
+	return r.db.WithTx(ctx, func(tx *sql.Tx) error {
+		return fn(&PostgresTaskRepository{db: r.db, q: tx, stmts: r.stmts})
+	})
+}
+
+// WithRetryTx is WithTx, retrying the transaction on serialization failures
+// and deadlocks. fn may run more than once.
+func (r *PostgresTaskRepository) WithRetryTx(ctx context.Context, fn func(tasks TaskRepository) error) error {
+	return r.db.WithRetryTx(ctx, func(tx *sql.Tx) error {
+		return fn(&PostgresTaskRepository{db: r.db, q: tx, stmts: r.stmts})
+	})
+}
+
+func (r *PostgresTaskRepository) CreateTasksBatch(ctx context.Context, userID string, tasks []*models.Task) error {
+	return CreateTasksBatch(ctx, r.q, userID, tasks)
+}
+
+func (r *PostgresTaskRepository) ClaimIdempotencyKey(ctx context.Context, userID string, key string, ttlHours int) (string, bool, error) {
+	return ClaimIdempotencyKey(ctx, r.q, userID, key, ttlHours)
+}
+
+func (r *PostgresTaskRepository) SetIdempotencyKeyTask(ctx context.Context, userID string, key string, taskID string) error {
+	return SetIdempotencyKeyTask(ctx, r.q, userID, key, taskID)
+}
+
+func (r *PostgresTaskRepository) CountActiveTasksLocked(ctx context.Context, userID string) (int, error) {
+	return CountActiveTasksLocked(ctx, r.q, userID)
+}
+
+func (r *PostgresTaskRepository) GetTaskWithOwner(taskID string) (*models.Task, error) {
+	return GetTaskWithOwner(r.q, taskID)
+}
+
+func (r *PostgresTaskRepository) GetTaskByIDForUpdate(taskID string) (*models.Task, error) {
+	return GetTaskByIDForUpdate(r.q, taskID)
+}
+
+func (r *PostgresTaskRepository) GetAllTasks(filter models.TaskFilter) ([]*models.Task, error) {
+	return GetAllTasks(r.q, filter)
+}
+
+func (r *PostgresTaskRepository) CountUserTasks(userID string, filter models.TaskFilter) (int, error) {
+	return CountUserTasks(r.q, userID, filter)
+}
+
+func (r *PostgresTaskRepository) CountAllTasks(filter models.TaskFilter) (int, error) {
+	return CountAllTasks(r.q, filter)
+}
+
+func (r *PostgresTaskRepository) UpdateTask(task *models.Task) error {
+	return UpdateTask(r.q, task)
+}
+
+func (r *PostgresTaskRepository) ReassignTask(taskID string, userID string) error {
+	return ReassignTask(r.q, taskID, userID)
+}
+
+func (r *PostgresTaskRepository) TransferTasks(ctx context.Context, fromUserID string, toUserID string) (int64, error) {
+	return TransferTasks(ctx, r.q, fromUserID, toUserID)
+}
+
+func (r *PostgresTaskRepository) DeleteTask(taskID string) error {
+	return DeleteTask(r.q, taskID)
+}
+
+func (r *PostgresTaskRepository) HardDeleteTask(taskID string) error {
+	return HardDeleteTask(r.q, taskID)
+}
+
+func (r *PostgresTaskRepository) RestoreTask(taskID string, userID string, isAdmin bool) (*models.Task, error) {
+	return RestoreTask(r.q, taskID, userID, isAdmin)
+}
+
+func (r *PostgresTaskRepository) SetTaskArchived(taskID string, archived bool) (*models.Task, error) {
+	return SetTaskArchived(r.q, taskID, archived)
+}
+
+func (r *PostgresTaskRepository) DeleteTasks(ctx context.Context, ids []string, userID string, isAdmin bool) (int64, error) {
+	return DeleteTasks(ctx, r.q, ids, userID, isAdmin)
+}
+
+func (r *PostgresTaskRepository) CountTasksByStatus(ctx context.Context, userID string, isAdmin bool) (map[string]int, error) {
+	return CountTasksByStatus(ctx, r.q, userID, isAdmin)
+}
+
+func (r *PostgresTaskRepository) GetTaskBoard(ctx context.Context, userID string, perColumn int) ([]*models.Task, error) {
+	return GetTaskBoard(ctx, r.q, userID, perColumn)
+}
+
+func (r *PostgresTaskRepository) GetUpcomingTasks(ctx context.Context, userID string, before time.Time, limit int) ([]*models.Task, error) {
+	return GetUpcomingTasks(ctx, r.q, userID, before, limit)
+}
+
+func (r *PostgresTaskRepository) CountTasksByDay(ctx context.Context, from time.Time, to time.Time) ([]models.DailyTaskCount, error) {
+	return CountTasksByDay(ctx, r.q, from, to)
+}
+
+func (r *PostgresTaskRepository) AutoCompleteDueTasks(ctx context.Context, minutes int) ([]AutoCompletedTask, error) {
+	return AutoCompleteDueTasks(ctx, r.q, minutes)
+}
+
+func (r *PostgresTaskRepository) GetTasksForAutoCompletion(ctx context.Context, minutes int) ([]*models.Task, error) {
+	return GetTasksForAutoCompletion(ctx, r.q, minutes)
+}
+
+func (r *PostgresTaskRepository) PurgeCompletedTasks(ctx context.Context, days int) (int64, error) {
+	return PurgeCompletedTasks(ctx, r.q, days)
+}
+
+func (r *PostgresTaskRepository) AutoCompleteTask(taskID string) (bool, error) {
+	return AutoCompleteTask(r.q, taskID)
+}
+
+func (r *PostgresTaskRepository) GetRecurringTasksDue() ([]*models.Task, error) {
+	return GetRecurringTasksDue(r.q)
+}
+
+func (r *PostgresTaskRepository) ClearTaskNextRun(taskID string) error {
+	return ClearTaskNextRun(r.q, taskID)
+}
+
+func (r *PostgresTaskRepository) RecordStatusChange(taskID string, oldStatus string, newStatus string, changedBy string) error {
+	return RecordStatusChange(r.q, taskID, oldStatus, newStatus, changedBy)
+}
+
+func (r *PostgresTaskRepository) GetTaskStatusHistory(taskID string) ([]*models.TaskStatusChange, error) {
+	return GetTaskStatusHistory(r.q, taskID)
+}
@@ -0,0 +1,147 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+
+	"github.com/lib/pq"
+	"taskapi/database"
+	"taskapi/models"
+)
+
+// The task repository prepares its most frequent queries once instead of
+// sending their SQL with every call. lib/pq otherwise parses and describes
+// each parameterised query in its own round trip before executing it.
+// database/sql prepares a statement lazily on each pooled connection that
+// uses it, and inside a transaction the statement is re-bound to the
+// transaction's connection.
+
+const getTaskByIDQuery = `
+	SELECT ` + taskColumns + `
+	FROM tasks WHERE id = $1 AND deleted_at IS NULL
+`
+
+const createTaskQuery = `
+	INSERT INTO tasks (user_id, title, description, status, tags, due_date, recurrence, next_run_at, auto_complete)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id, version, created_at, updated_at
+`
+
+// maxListStatements caps how many GetUserTasks query shapes are kept
+// prepared. Each combination of filters and sort order is one shape; shapes
+// beyond the cap run unprepared.
+const maxListStatements = 64
+
+// taskStatements holds the task repository's prepared statements
+type taskStatements struct {
+	conn        *sql.DB
+	getTaskByID *sql.Stmt
+	createTask  *sql.Stmt
+
+	mu     sync.Mutex
+	lists  map[string]*sql.Stmt // GetUserTasks statements by SQL text
+	closed bool
+}
+
+// prepareTaskStatements prepares the fixed statements on the pool
+func prepareTaskStatements(conn *sql.DB) (*taskStatements, error) {
+	getTaskByID, err := conn.Prepare(getTaskByIDQuery)
+	if err != nil {
+		return nil, err
+	}
+	createTask, err := conn.Prepare(createTaskQuery)
+	if err != nil {
+		getTaskByID.Close()
+		return nil, err
+	}
+
+	return &taskStatements{
+		conn:        conn,
+		getTaskByID: getTaskByID,
+		createTask:  createTask,
+		lists:       make(map[string]*sql.Stmt),
+	}, nil
+}
+
+// list returns the prepared statement for a GetUserTasks query, preparing
+// it on first use. It returns nil once the cache is full or closed.
+func (s *taskStatements) list(query string) (*sql.Stmt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stmt, ok := s.lists[query]; ok {
+		return stmt, nil
+	}
+	if s.closed || len(s.lists) >= maxListStatements {
+		return nil, nil
+	}
+
+	stmt, err := s.conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	s.lists[query] = stmt
+	return stmt, nil
+}
+
+// Close closes every prepared statement
+func (s *taskStatements) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	errs := []error{s.getTaskByID.Close(), s.createTask.Close()}
+	for query, stmt := range s.lists {
+		errs = append(errs, stmt.Close())
+		delete(s.lists, query)
+	}
+	return errors.Join(errs...)
+}
+
+// bind returns stmt bound to q when q is a transaction, and stmt otherwise
+func bind(q database.Querier, stmt *sql.Stmt) *sql.Stmt {
+	if tx, ok := q.(*sql.Tx); ok {
+		return tx.Stmt(stmt)
+	}
+	return stmt
+}
+
+// CreateTask creates a new task
+func (r *PostgresTaskRepository) CreateTask(task *models.Task) error {
+	row := bind(r.q, r.stmts.createTask).QueryRow(task.UserID, task.Title, task.Description, models.StatusPending, pq.Array(task.Tags), task.DueDate, task.Recurrence, task.NextRunAt, task.AutoComplete)
+	return taskConflict(row.Scan(&task.ID, &task.Version, &task.CreatedAt, &task.UpdatedAt))
+}
+
+// GetTaskByID retrieves a task by ID
+func (r *PostgresTaskRepository) GetTaskByID(taskID string) (*models.Task, error) {
+	task, err := scanTask(bind(r.q, r.stmts.getTaskByID).QueryRow(taskID))
+
+	if err == sql.ErrNoRows {
+		return nil, ErrTaskNotFound
+	}
+
+	return task, err
+}
+
+// GetUserTasks retrieves a user's tasks matching the filter
+func (r *PostgresTaskRepository) GetUserTasks(userID string, filter models.TaskFilter) ([]*models.Task, error) {
+	query, args, err := taskListQuery([]string{"user_id = $1"}, []interface{}{userID}, filter, filter.IncludeOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := r.stmts.list(query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return listTasks(r.q, []string{"user_id = $1"}, []interface{}{userID}, filter, filter.IncludeOwner)
+	}
+
+	rows, err := bind(r.q, stmt).Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanTaskList(rows, filter.IncludeOwner)
+}
@@ -1,138 +1,1099 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
 	"taskapi/database"
 	"taskapi/models"
 )
 
-// UserRepository handles user database operations
-type UserRepository struct {
-	db *database.DB
-}
+// ErrNotFound is wrapped by every error returned when a row does not exist
+var ErrNotFound = errors.New("not found")
 
-// NewUserRepository creates a new user repository
-func NewUserRepository(db *database.DB) *UserRepository {
-	return &UserRepository{db: db}
-}
+// Errors returned for missing rows of each kind
+var (
+	ErrUserNotFound        = fmt.Errorf("user %w", ErrNotFound)
+	ErrAPIKeyNotFound      = fmt.Errorf("api key %w", ErrNotFound)
+	ErrTaskNotFound        = fmt.Errorf("task %w", ErrNotFound)
+	ErrDeletedTaskNotFound = fmt.Errorf("deleted task %w", ErrNotFound)
+)
+
+// ErrUserExists is returned when a user's email or username is already taken
+var ErrUserExists = errors.New("user already exists")
+
+// ErrEmailTaken and ErrUsernameTaken name the field that clashed with
+// another user
+var (
+	ErrEmailTaken    = errors.New("email is already taken")
+	ErrUsernameTaken = errors.New("username is already taken")
+)
+
+// ErrInvalidResetToken is returned when a password reset token is unknown,
+// used or expired
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// ErrIdempotentTaskGone is returned when an idempotency key was used for a
+// task that has since been permanently deleted
+var ErrIdempotentTaskGone = errors.New("original task for this idempotency key no longer exists")
+
+// ErrDuplicateTaskTitle is returned when UNIQUE_TASK_TITLES_PER_USER is
+// enabled and the user already has an open task with the same title
+var ErrDuplicateTaskTitle = errors.New("task title already exists")
+
+// uniqueViolation is the PostgreSQL error code for a unique constraint violation
+const uniqueViolation = "23505"
 
 // CreateUser creates a new user in the database
-func CreateUser(db *database.DB, user *models.User) error {
+func CreateUser(db database.Querier, user *models.User) error {
 	query := `
 		INSERT INTO users (email, username, password, role)
 		VALUES ($1, $2, $3, $4)
 		RETURNING id, created_at
 	`
 
-	row := db.Conn.QueryRow(query, user.Email, user.Username, user.Password, user.Role)
-	return row.Scan(&user.ID, &user.CreatedAt)
+	row := db.QueryRow(query, user.Email, user.Username, user.Password, user.Role)
+	err := row.Scan(&user.ID, &user.CreatedAt)
+	return userConflict(err)
+}
+
+// userConflict maps a unique violation on the users table to the error
+// naming the clashing field, or ErrUserExists if the constraint is unknown,
+// and returns any other error unchanged
+func userConflict(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != uniqueViolation {
+		return err
+	}
+	switch pqErr.Constraint {
+	case "users_email_key":
+		return ErrEmailTaken
+	case "users_username_key":
+		return ErrUsernameTaken
+	}
+	return ErrUserExists
+}
+
+// taskConflict maps a violation of the per-user unique task title index to
+// ErrDuplicateTaskTitle and returns any other error unchanged
+func taskConflict(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation && pqErr.Constraint == database.UniqueTaskTitlesIndex {
+		return ErrDuplicateTaskTitle
+	}
+	return err
+}
+
+// UpdateUserProfile changes a user's email and username, returning the
+// updated user. A new email is no longer verified. A clash with another
+// user returns ErrEmailTaken or ErrUsernameTaken.
+func UpdateUserProfile(db database.Querier, id string, email string, username string) (*models.User, error) {
+	query := `
+		UPDATE users SET email = $1, username = $2, email_verified = email_verified AND email = $1
+		WHERE id = $3
+		RETURNING id, email, username, role, email_verified, last_login_at, created_at
+	`
+
+	user := &models.User{}
+	err := db.QueryRow(query, email, username, id).Scan(&user.ID, &user.Email, &user.Username, &user.Role, &user.EmailVerified, &user.LastLoginAt, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, userConflict(err)
+	}
+	return user, nil
 }
 
 // GetUserByEmail retrieves a user by email
-func GetUserByEmail(db *database.DB, email string) (*models.User, error) {
-	query := `SELECT id, email, username, password, role, created_at FROM users WHERE email = $1`
+func GetUserByEmail(db database.Querier, email string) (*models.User, error) {
+	query := `SELECT id, email, username, password, role, email_verified, last_login_at, created_at FROM users WHERE email = $1`
 
 	user := &models.User{}
-	row := db.Conn.QueryRow(query, email)
-	err := row.Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.Role, &user.CreatedAt)
+	row := db.QueryRow(query, email)
+	err := row.Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.Role, &user.EmailVerified, &user.LastLoginAt, &user.CreatedAt)
 
 	if err == sql.ErrNoRows {
-		return nil, errors.New("user not found")
+		return nil, ErrUserNotFound
 	}
 
 	return user, err
 }
 
 // GetUserByID retrieves a user by ID (package-level helper)
-func GetUserByID(db *database.DB, id string) (*models.User, error) {
-	query := `SELECT id, email, username, password, role, created_at FROM users WHERE id = $1`
+func GetUserByID(db database.Querier, id string) (*models.User, error) {
+	query := `SELECT id, email, username, password, role, email_verified, last_login_at, created_at FROM users WHERE id = $1`
 
 	user := &models.User{}
-	row := db.Conn.QueryRow(query, id)
-	err := row.Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.Role, &user.CreatedAt)
+	row := db.QueryRow(query, id)
+	err := row.Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.Role, &user.EmailVerified, &user.LastLoginAt, &user.CreatedAt)
 
 	if err == sql.ErrNoRows {
-		return nil, errors.New("user not found")
+		return nil, ErrUserNotFound
 	}
 
 	return user, err
 }
 
-// TaskRepository handles task database operations
-type TaskRepository struct {
-	db *database.DB
+// GetUsers retrieves a page of users matching the filter. The password hash
+// is never selected.
+func GetUsers(ctx context.Context, db database.Querier, filter models.UserFilter) ([]*models.User, error) {
+	order, err := userSortOrder(filter.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args := userConditions(filter)
+	args = append(args, filter.Limit, filter.Offset)
+	query := fmt.Sprintf(`
+		SELECT id, email, username, role, email_verified, last_login_at, created_at
+		FROM users%s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`, where, order, len(args)-1, len(args))
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user := &models.User{}
+		if err := rows.Scan(&user.ID, &user.Email, &user.Username, &user.Role, &user.EmailVerified, &user.LastLoginAt, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
 }
 
-// NewTaskRepository creates a new task repository
-func NewTaskRepository(db *database.DB) *TaskRepository {
-	return &TaskRepository{db: db}
+// CountUsers counts the users matching the filter, ignoring its paging
+func CountUsers(ctx context.Context, db database.Querier, filter models.UserFilter) (int, error) {
+	where, args := userConditions(filter)
+
+	var count int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`+where, args...).Scan(&count)
+	return count, err
+}
+
+// userConditions builds the WHERE clause, if any, and arguments for a user
+// filter
+func userConditions(filter models.UserFilter) (string, []interface{}) {
+	if filter.Search == "" {
+		return "", nil
+	}
+	pattern := "%" + likeEscaper.Replace(filter.Search) + "%"
+	return ` WHERE (email ILIKE $1 ESCAPE '\' OR username ILIKE $1 ESCAPE '\')`, []interface{}{pattern}
 }
 
-// CreateTask creates a new task
-func CreateTask(db *database.DB, task *models.Task) error {
+// userSortColumns maps the fields a user list can be sorted by to their
+// columns
+var userSortColumns = map[string]string{
+	"created_at": "created_at",
+	"email":      "email",
+	"username":   "username",
+}
+
+// DefaultUserSort is used when a user filter has no sort
+const DefaultUserSort = "-created_at"
+
+// UserSortFields lists the accepted user sort fields
+var UserSortFields = []string{"created_at", "email", "username"}
+
+// userSortOrder builds the ORDER BY clause for a user list
+func userSortOrder(sort string) (string, error) {
+	if sort == "" {
+		sort = DefaultUserSort
+	}
+	return sortOrder(sort, userSortColumns, nil)
+}
+
+// ValidateUserSort checks a user sort value, returning an error naming the
+// first bad field
+func ValidateUserSort(sort string) error {
+	_, err := userSortOrder(sort)
+	return err
+}
+
+// DeleteUser deletes a user (tasks are removed by ON DELETE CASCADE)
+func DeleteUser(db database.Querier, id string) error {
+	query := `DELETE FROM users WHERE id = $1`
+	result, err := db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// TouchLastLogin records that a user has just logged in
+func TouchLastLogin(db database.Querier, id string) error {
+	query := `UPDATE users SET last_login_at = NOW() WHERE id = $1`
+	_, err := db.Exec(query, id)
+	return err
+}
+
+// UpdateUserRole changes a user's role
+func UpdateUserRole(db database.Querier, id string, role string) error {
+	query := `UPDATE users SET role = $1 WHERE id = $2`
+	result, err := db.Exec(query, role, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// LockAdmins locks every admin row until the surrounding transaction ends,
+// so concurrent role changes can't both demote "the other" last admin
+func LockAdmins(db database.Querier) error {
+	rows, err := db.Query(`SELECT id FROM users WHERE role = 'admin' FOR UPDATE`)
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// CountAdmins returns the number of users with the admin role
+func CountAdmins(db database.Querier) (int, error) {
+	query := `SELECT COUNT(*) FROM users WHERE role = 'admin'`
+
+	var count int
+	err := db.QueryRow(query).Scan(&count)
+	return count, err
+}
+
+// UpdateUserPassword replaces a user's password hash
+func UpdateUserPassword(db database.Querier, id string, passwordHash string) error {
+	query := `UPDATE users SET password = $1 WHERE id = $2`
+	result, err := db.Exec(query, passwordHash, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// CreatePasswordReset stores the hash of a reset token for a user
+func CreatePasswordReset(db database.Querier, userID string, tokenHash string, expiresAt time.Time) error {
 	query := `
-		INSERT INTO tasks (user_id, title, description, status)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at, updated_at
+		INSERT INTO password_resets (token_hash, user_id, expires_at)
+		VALUES ($1, $2, $3)
+	`
+
+	_, err := db.Exec(query, tokenHash, userID, expiresAt)
+	return err
+}
+
+// ConsumePasswordReset marks an unused, unexpired reset token as used and
+// returns its user. The single UPDATE means a token can't be redeemed twice.
+func ConsumePasswordReset(db database.Querier, tokenHash string) (string, error) {
+	query := `
+		UPDATE password_resets SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`
+
+	var userID string
+	err := db.QueryRow(query, tokenHash).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidResetToken
+	}
+	return userID, err
+}
+
+// InvalidatePasswordResets marks every outstanding reset token for a user as used
+func InvalidatePasswordResets(db database.Querier, userID string) error {
+	query := `UPDATE password_resets SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`
+	_, err := db.Exec(query, userID)
+	return err
+}
+
+// ErrInvalidVerificationToken is returned when an email verification token
+// is unknown, used or expired
+var ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+
+// CreateEmailVerification stores the hash of an email verification token for a user
+func CreateEmailVerification(db database.Querier, userID string, tokenHash string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO email_verifications (token_hash, user_id, expires_at)
+		VALUES ($1, $2, $3)
+	`
+
+	_, err := db.Exec(query, tokenHash, userID, expiresAt)
+	return err
+}
+
+// ConsumeEmailVerification marks an unused, unexpired verification token as
+// used and returns its user
+func ConsumeEmailVerification(db database.Querier, tokenHash string) (string, error) {
+	query := `
+		UPDATE email_verifications SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`
+
+	var userID string
+	err := db.QueryRow(query, tokenHash).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidVerificationToken
+	}
+	return userID, err
+}
+
+// InvalidateEmailVerifications marks every outstanding verification token for a user as used
+func InvalidateEmailVerifications(db database.Querier, userID string) error {
+	query := `UPDATE email_verifications SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`
+	_, err := db.Exec(query, userID)
+	return err
+}
+
+// MarkEmailVerified records that a user has confirmed their email address
+func MarkEmailVerified(db database.Querier, userID string) error {
+	query := `UPDATE users SET email_verified = TRUE WHERE id = $1`
+	result, err := db.Exec(query, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// CreateAPIKey stores the hash of a new API key for a user
+func CreateAPIKey(db database.Querier, userID string, keyHash string, apiKey *models.APIKey) error {
+	query := `
+		INSERT INTO api_keys (user_id, key_hash, label)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
 	`
 
-	row := db.Conn.QueryRow(query, task.UserID, task.Title, task.Description, "pending")
-	return row.Scan(&task.ID, &task.CreatedAt, &task.UpdatedAt)
+	row := db.QueryRow(query, userID, keyHash, apiKey.Label)
+	return row.Scan(&apiKey.ID, &apiKey.CreatedAt)
 }
 
-// GetTaskByID retrieves a task by ID
-func GetTaskByID(db *database.DB, taskID string) (*models.Task, error) {
+// GetUserAPIKeys lists a user's API keys, newest first
+func GetUserAPIKeys(db database.Querier, userID string) ([]*models.APIKey, error) {
 	query := `
-		SELECT id, user_id, title, description, status, created_at, updated_at
-		FROM tasks WHERE id = $1
+		SELECT id, label, created_at, last_used_at
+		FROM api_keys WHERE user_id = $1
+		ORDER BY created_at DESC
 	`
 
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+	for rows.Next() {
+		key := &models.APIKey{}
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&key.ID, &key.Label, &key.CreatedAt, &lastUsed); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			key.LastUsedAt = &lastUsed.Time
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// DeleteAPIKey revokes one of a user's API keys
+func DeleteAPIKey(db database.Querier, id string, userID string) error {
+	query := `DELETE FROM api_keys WHERE id = $1 AND user_id = $2`
+	result, err := db.Exec(query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// GetUserByAPIKey returns the owner of the API key with the given hash and
+// records the key as used
+func GetUserByAPIKey(db database.Querier, keyHash string) (*models.User, error) {
+	query := `
+		UPDATE api_keys k SET last_used_at = NOW()
+		FROM users u
+		WHERE k.key_hash = $1 AND u.id = k.user_id
+		RETURNING u.id, u.email, u.username, u.password, u.role, u.email_verified, u.last_login_at, u.created_at
+	`
+
+	user := &models.User{}
+	row := db.QueryRow(query, keyHash)
+	err := row.Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.Role, &user.EmailVerified, &user.LastLoginAt, &user.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	return user, err
+}
+
+// taskColumns is the column list selected for a task, matching scanTask
+const taskColumns = `id, user_id, title, description, status, version, tags, due_date, recurrence, next_run_at, archived_at, auto_complete, created_at, updated_at`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTask scans a row selected with taskColumns into a task. Any extra
+// destinations receive columns selected after taskColumns.
+func scanTask(row rowScanner, extra ...interface{}) (*models.Task, error) {
 	task := &models.Task{}
-	row := db.Conn.QueryRow(query, taskID)
-	err := row.Scan(&task.ID, &task.UserID, &task.Title, &task.Description, &task.Status, &task.CreatedAt, &task.UpdatedAt)
+	var dueDate, nextRunAt, archivedAt sql.NullTime
+	dest := []interface{}{&task.ID, &task.UserID, &task.Title, &task.Description, &task.Status, &task.Version, pq.Array(&task.Tags), &dueDate, &task.Recurrence, &nextRunAt, &archivedAt, &task.AutoComplete, &task.CreatedAt, &task.UpdatedAt}
+	err := row.Scan(append(dest, extra...)...)
+	if dueDate.Valid {
+		task.DueDate = &dueDate.Time
+	}
+	if nextRunAt.Valid {
+		task.NextRunAt = &nextRunAt.Time
+	}
+	if archivedAt.Valid {
+		task.ArchivedAt = &archivedAt.Time
+	}
+	return task, err
+}
+
+// scanTaskWithOwner scans a row selected with taskColumns followed by the
+// owner's username and email
+func scanTaskWithOwner(row rowScanner) (*models.Task, error) {
+	var username, email string
+	task, err := scanTask(row, &username, &email)
+	if err != nil {
+		return task, err
+	}
+	task.Owner = &models.TaskOwner{ID: task.UserID, Username: username, Email: email}
+	return task, nil
+}
+
+// withOwner wraps a query selecting taskColumns so it also selects the
+// owner's username and email, in the order given
+func withOwner(query string, order string) string {
+	return `
+		SELECT t.*, u.username, u.email
+		FROM (` + query + `) t
+		JOIN users u ON u.id = t.user_id
+		ORDER BY ` + order
+}
+
+// ErrVersionConflict is returned when a task was modified since it was read
+var ErrVersionConflict = errors.New("task was modified by another request")
+
+// CreateTasksBatch creates several tasks for a user with a single multi-row
+// INSERT, filling in every task's ID, version and timestamps as stored. The
+// insert is atomic on its own; run it inside a transaction to combine it with
+// checks.
+func CreateTasksBatch(ctx context.Context, db database.Querier, userID string, tasks []*models.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	// Postgres doesn't promise to return RETURNING rows in VALUES order, so
+	// the IDs are generated first and each returned row is matched by ID
+	ids, err := newTaskIDs(ctx, db, len(tasks))
+	if err != nil {
+		return err
+	}
+
+	placeholders := make([]string, 0, len(tasks))
+	args := make([]interface{}, 0, len(tasks)*9+1)
+	args = append(args, userID)
+	byID := make(map[string]*models.Task, len(tasks))
+	for i, task := range tasks {
+		n := i*9 + 2
+		placeholders = append(placeholders, fmt.Sprintf("($%d, $1, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)", n, n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8))
+		args = append(args, ids[i], task.Title, task.Description, models.StatusPending, pq.Array(task.Tags), task.DueDate, task.Recurrence, task.NextRunAt, task.AutoComplete)
+		byID[ids[i]] = task
+	}
+
+	query := `
+		INSERT INTO tasks (id, user_id, title, description, status, tags, due_date, recurrence, next_run_at, auto_complete)
+		VALUES ` + strings.Join(placeholders, ", ") + `
+		RETURNING id, version, created_at, updated_at
+	`
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return taskConflict(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var version int
+		var createdAt, updatedAt time.Time
+		if err := rows.Scan(&id, &version, &createdAt, &updatedAt); err != nil {
+			return err
+		}
+		task, ok := byID[id]
+		if !ok {
+			return fmt.Errorf("batch insert returned unknown task %s", id)
+		}
+		task.ID, task.Version, task.CreatedAt, task.UpdatedAt = id, version, createdAt, updatedAt
+		task.UserID = userID
+		task.Status = models.StatusPending
+		delete(byID, id)
+	}
+	if err := rows.Err(); err != nil {
+		return taskConflict(err)
+	}
+	if len(byID) > 0 {
+		return fmt.Errorf("batch insert returned %d of %d tasks", len(tasks)-len(byID), len(tasks))
+	}
+	return nil
+}
+
+// newTaskIDs has Postgres generate n task IDs, the same way the id column's
+// default does
+func newTaskIDs(ctx context.Context, db database.Querier, n int) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT gen_random_uuid() FROM generate_series(1, $1)`, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]string, 0, n)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ClaimIdempotencyKey reserves a user's idempotency key. If the key was
+// already used within ttlHours it returns the original task ID and false.
+// Concurrent claims of the same key are serialized by the primary key on
+// idempotency_keys: the second insert waits for the first transaction to
+// commit, so this must run inside the transaction that creates the task.
+func ClaimIdempotencyKey(ctx context.Context, db database.Querier, userID string, key string, ttlHours int) (string, bool, error) {
+	// Expired keys may be reused
+	_, err := db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2 AND created_at < NOW() - INTERVAL '1 hour' * $3
+	`, userID, key, ttlHours)
+	if err != nil {
+		return "", false, err
+	}
+
+	result, err := db.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (user_id, key)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, userID, key)
+	if err != nil {
+		return "", false, err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return "", false, err
+	}
+	if inserted > 0 {
+		return "", true, nil
+	}
+
+	var taskID sql.NullString
+	row := db.QueryRowContext(ctx, `SELECT task_id FROM idempotency_keys WHERE user_id = $1 AND key = $2`, userID, key)
+	if err := row.Scan(&taskID); err != nil {
+		return "", false, err
+	}
+	if !taskID.Valid {
+		return "", false, ErrIdempotentTaskGone
+	}
+	return taskID.String, false, nil
+}
+
+// SetIdempotencyKeyTask records the task created for a claimed key
+func SetIdempotencyKeyTask(ctx context.Context, db database.Querier, userID string, key string, taskID string) error {
+	_, err := db.ExecContext(ctx, `UPDATE idempotency_keys SET task_id = $1 WHERE user_id = $2 AND key = $3`, taskID, userID, key)
+	return err
+}
+
+// CountActiveTasksLocked counts a user's open (not closed) tasks while holding a
+// per-user advisory lock until the transaction ends, so concurrent creates
+// can't both pass a quota check. It must be called within a transaction.
+func CountActiveTasksLocked(ctx context.Context, db database.Querier, userID string) (int, error) {
+	if _, err := db.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, userID); err != nil {
+		return 0, err
+	}
+
+	query := `
+		SELECT COUNT(*) FROM tasks
+		WHERE user_id = $1 AND status <> ALL($2) AND deleted_at IS NULL
+	`
+
+	var count int
+	err := db.QueryRowContext(ctx, query, userID, pq.Array(models.ClosedStatuses)).Scan(&count)
+	return count, err
+}
+
+// GetTaskWithOwner retrieves a task along with its owner's details
+func GetTaskWithOwner(db database.Querier, taskID string) (*models.Task, error) {
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	task, err := scanTaskWithOwner(db.QueryRow(withOwner(query, "id"), taskID))
 
 	if err == sql.ErrNoRows {
-		return nil, errors.New("task not found")
+		return nil, ErrTaskNotFound
 	}
 
 	return task, err
 }
 
-// GetUserTasks retrieves all tasks for a user
-func GetUserTasks(db *database.DB, userID string) ([]*models.Task, error) {
+// GetTaskByIDForUpdate retrieves a task and locks its row until the
+// surrounding transaction ends. It must be called within a transaction.
+func GetTaskByIDForUpdate(db database.Querier, taskID string) (*models.Task, error) {
 	query := `
-		SELECT id, user_id, title, description, status, created_at, updated_at
-		FROM tasks WHERE user_id = $1
-		ORDER BY created_at DESC
+		SELECT ` + taskColumns + `
+		FROM tasks WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
 	`
 
-	rows, err := db.Conn.Query(query, userID)
+	task, err := scanTask(db.QueryRow(query, taskID))
+
+	if err == sql.ErrNoRows {
+		return nil, ErrTaskNotFound
+	}
+
+	return task, err
+}
+
+// taskSortColumns maps the fields a task list can be sorted by to their
+// columns. Only these fixed strings are ever interpolated into a query.
+var taskSortColumns = map[string]string{
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+	"status":     "status",
+	"title":      "title",
+	"due_date":   "due_date",
+}
+
+// DefaultTaskSort is used when a filter has no sort. It is the only order
+// keyset cursors work with, since they compare (created_at, id).
+const DefaultTaskSort = "-created_at"
+
+// TaskSortFields lists the accepted sort fields, for documentation and errors
+var TaskSortFields = []string{"created_at", "updated_at", "status", "title", "due_date"}
+
+// taskSortOrder builds the ORDER BY clause for a task list. Tasks without a
+// due date sort last either way.
+func taskSortOrder(sort string) (string, error) {
+	if sort == "" {
+		sort = DefaultTaskSort
+	}
+	return sortOrder(sort, taskSortColumns, map[string]bool{"due_date": true})
+}
+
+// sortOrder builds an ORDER BY clause for a comma-separated sort value such
+// as "status,-created_at", accepting only the fields in columns. A leading
+// "-" sorts that field descending, and fields in nullsLast put rows without
+// a value last. id breaks ties, in the direction of the last field, so pages
+// are stable.
+func sortOrder(sort string, columns map[string]string, nullsLast map[string]bool) (string, error) {
+	var terms []string
+	seen := make(map[string]bool)
+	direction := "ASC"
+	for _, field := range strings.Split(sort, ",") {
+		field = strings.TrimSpace(field)
+		direction = "ASC"
+		if strings.HasPrefix(field, "-") {
+			field = strings.TrimPrefix(field, "-")
+			direction = "DESC"
+		}
+
+		column, ok := columns[field]
+		if !ok {
+			return "", fmt.Errorf("invalid sort field %q", field)
+		}
+		if seen[field] {
+			return "", fmt.Errorf("duplicate sort field %q", field)
+		}
+		seen[field] = true
+
+		nulls := ""
+		if nullsLast[field] {
+			nulls = " NULLS LAST"
+		}
+		terms = append(terms, column+" "+direction+nulls)
+	}
+	return strings.Join(append(terms, "id "+direction), ", "), nil
+}
+
+// ValidateTaskSort checks a sort value, returning an error naming the first
+// bad field
+func ValidateTaskSort(sort string) error {
+	_, err := taskSortOrder(sort)
+	return err
+}
+
+// GetAllTasks retrieves all tasks matching the filter, with their owners (for admin)
+func GetAllTasks(db database.Querier, filter models.TaskFilter) ([]*models.Task, error) {
+	return listTasks(db, nil, nil, filter, true)
+}
+
+// CountUserTasks counts a user's tasks matching the filter, ignoring its
+// paging (limit, offset and cursor)
+func CountUserTasks(db database.Querier, userID string, filter models.TaskFilter) (int, error) {
+	return countTasks(db, []string{"user_id = $1"}, []interface{}{userID}, filter)
+}
+
+// CountAllTasks counts all tasks matching the filter, ignoring its paging
+func CountAllTasks(db database.Querier, filter models.TaskFilter) (int, error) {
+	return countTasks(db, nil, nil, filter)
+}
+
+// taskConditions appends the filter's conditions on non-deleted tasks to
+// where and args. Filter values are always passed as query parameters.
+func taskConditions(where []string, args []interface{}, filter models.TaskFilter) ([]string, []interface{}) {
+	where = append(where, "deleted_at IS NULL")
+	if filter.UserID != "" {
+		args = append(args, filter.UserID)
+		where = append(where, fmt.Sprintf("user_id = $%d", len(args)))
+	}
+	if filter.Archived {
+		where = append(where, "archived_at IS NOT NULL")
+	} else {
+		where = append(where, "archived_at IS NULL")
+	}
+	if filter.CreatedAfter != nil {
+		args = append(args, *filter.CreatedAfter)
+		where = append(where, fmt.Sprintf("created_at > $%d", len(args)))
+	}
+	if filter.CreatedBefore != nil {
+		args = append(args, *filter.CreatedBefore)
+		where = append(where, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+	if filter.Tag != "" {
+		// Containment (@>) rather than ANY() so the GIN index on tags is used
+		args = append(args, pq.Array([]string{filter.Tag}))
+		where = append(where, fmt.Sprintf("tags @> $%d", len(args)))
+	}
+	if len(filter.Statuses) > 0 {
+		args = append(args, pq.Array(filter.Statuses))
+		where = append(where, fmt.Sprintf("status = ANY($%d)", len(args)))
+	}
+	if filter.Search != "" {
+		args = append(args, "%"+likeEscaper.Replace(filter.Search)+"%")
+		where = append(where, fmt.Sprintf(`(title ILIKE $%d ESCAPE '\' OR description ILIKE $%d ESCAPE '\')`, len(args), len(args)))
+	}
+	return where, args
+}
+
+// likeEscaper escapes the LIKE wildcards in a search term so it only ever
+// matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// countTasks counts non-deleted tasks matching the given conditions and filter
+func countTasks(db database.Querier, where []string, args []interface{}, filter models.TaskFilter) (int, error) {
+	where, args = taskConditions(where, args, filter)
+
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM tasks WHERE `+strings.Join(where, " AND "), args...).Scan(&count)
+	return count, err
+}
+
+// listTasks selects non-deleted tasks matching the given conditions and
+// filter, optionally with their owners
+func listTasks(db database.Querier, where []string, args []interface{}, filter models.TaskFilter, includeOwner bool) ([]*models.Task, error) {
+	query, args, err := taskListQuery(where, args, filter, includeOwner)
 	if err != nil {
 		return nil, err
 	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanTaskList(rows, includeOwner)
+}
+
+// taskListQuery builds the query and arguments for listTasks
+func taskListQuery(where []string, args []interface{}, filter models.TaskFilter, includeOwner bool) (string, []interface{}, error) {
+	where, args = taskConditions(where, args, filter)
+	if filter.Cursor != nil {
+		// Row comparison matches the created_at DESC, id DESC order, so the
+		// next page starts right after the cursor even with equal timestamps
+		args = append(args, filter.Cursor.CreatedAt, filter.Cursor.ID)
+		where = append(where, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	order, err := taskSortOrder(filter.Sort)
+	if err != nil {
+		return "", nil, err
+	}
+
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY ` + order
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+	if includeOwner {
+		query = withOwner(query, order)
+	}
+	return query, args, nil
+}
+
+// scanTaskList reads every task from rows, then closes them
+func scanTaskList(rows *sql.Rows, includeOwner bool) ([]*models.Task, error) {
 	defer rows.Close()
 
 	var tasks []*models.Task
 	for rows.Next() {
-		task := &models.Task{}
-		if err := rows.Scan(&task.ID, &task.UserID, &task.Title, &task.Description, &task.Status, &task.CreatedAt, &task.UpdatedAt); err != nil {
+		var task *models.Task
+		var err error
+		if includeOwner {
+			task, err = scanTaskWithOwner(rows)
+		} else {
+			task, err = scanTask(rows)
+		}
+		if err != nil {
 			return nil, err
 		}
 		tasks = append(tasks, task)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
 	return tasks, nil
 }
 
-// GetAllTasks retrieves all tasks (for admin)
-func GetAllTasks(db *database.DB) ([]*models.Task, error) {
+// UpdateTask updates a task if its version still matches task.Version,
+// incrementing the version. A stale version returns ErrVersionConflict.
+func UpdateTask(db database.Querier, task *models.Task) error {
+	query := `
+		UPDATE tasks
+		SET title = $1, description = $2, status = $3, tags = $4, due_date = $5, recurrence = $6, next_run_at = $7,
+			auto_complete = $8, version = version + 1, updated_at = NOW()
+		WHERE id = $9 AND version = $10 AND deleted_at IS NULL
+		RETURNING version, updated_at
+	`
+
+	row := db.QueryRow(query, task.Title, task.Description, task.Status, pq.Array(task.Tags), task.DueDate, task.Recurrence, task.NextRunAt, task.AutoComplete, task.ID, task.Version)
+	err := row.Scan(&task.Version, &task.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrVersionConflict
+	}
+	return taskConflict(err)
+}
+
+// ReassignTask changes the owner of a task
+func ReassignTask(db database.Querier, taskID string, userID string) error {
+	query := `UPDATE tasks SET user_id = $1, updated_at = NOW() WHERE id = $2`
+	_, err := db.Exec(query, userID, taskID)
+	return taskConflict(err)
+}
+
+// TransferTasks moves all of a user's tasks, including deleted ones, to
+// another user and returns how many were moved. Each task's version is
+// bumped since its owner changed.
+func TransferTasks(ctx context.Context, db database.Querier, fromUserID string, toUserID string) (int64, error) {
+	query := `
+		UPDATE tasks
+		SET user_id = $2, version = version + 1, updated_at = NOW()
+		WHERE user_id = $1
+	`
+
+	result, err := db.ExecContext(ctx, query, fromUserID, toUserID)
+	if err != nil {
+		return 0, taskConflict(err)
+	}
+	return result.RowsAffected()
+}
+
+// DeleteTask soft-deletes a task by setting deleted_at
+func DeleteTask(db database.Querier, taskID string) error {
+	query := `UPDATE tasks SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
+	_, err := db.Exec(query, taskID)
+	return err
+}
+
+// HardDeleteTask permanently removes a task, including soft-deleted ones
+func HardDeleteTask(db database.Querier, taskID string) error {
+	query := `DELETE FROM tasks WHERE id = $1`
+	result, err := db.Exec(query, taskID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTaskNotFound
+	}
+
+	return nil
+}
+
+// RestoreTask clears deleted_at on a soft-deleted task. Non-admins can only
+// restore their own tasks.
+func RestoreTask(db database.Querier, taskID string, userID string, isAdmin bool) (*models.Task, error) {
+	query := `
+		UPDATE tasks
+		SET deleted_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NOT NULL AND ($2 OR user_id = $3)
+		RETURNING ` + taskColumns + `
+	`
+
+	task, err := scanTask(db.QueryRow(query, taskID, isAdmin, userID))
+
+	if err == sql.ErrNoRows {
+		return nil, ErrDeletedTaskNotFound
+	}
+
+	return task, taskConflict(err)
+}
+
+// SetTaskArchived archives or unarchives a task, bumping its version.
+// Archiving an already archived task keeps its original archived_at.
+func SetTaskArchived(db database.Querier, taskID string, archived bool) (*models.Task, error) {
 	query := `
-		SELECT id, user_id, title, description, status, created_at, updated_at
-		FROM tasks ORDER BY created_at DESC
+		UPDATE tasks
+		SET archived_at = CASE WHEN $2 THEN COALESCE(archived_at, NOW()) ELSE NULL END,
+			version = version + 1, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING ` + taskColumns + `
+	`
+
+	task, err := scanTask(db.QueryRow(query, taskID, archived))
+
+	if err == sql.ErrNoRows {
+		return nil, ErrTaskNotFound
+	}
+
+	return task, err
+}
+
+// DeleteTasks soft-deletes the given tasks in one query and returns how many
+// were removed. Non-admins can only delete their own tasks; ownership is enforced
+// in the WHERE clause so other users' IDs are silently skipped.
+func DeleteTasks(ctx context.Context, db database.Querier, ids []string, userID string, isAdmin bool) (int64, error) {
+	query := `
+		UPDATE tasks SET deleted_at = NOW()
+		WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL AND ($2 OR user_id = $3)
+	`
+
+	result, err := db.ExecContext(ctx, query, pq.Array(ids), isAdmin, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CountTasksByStatus returns the number of tasks per status for a user, or
+// across all users for admins
+func CountTasksByStatus(ctx context.Context, db database.Querier, userID string, isAdmin bool) (map[string]int, error) {
+	query := `
+		SELECT status, COUNT(*)
+		FROM tasks
+		WHERE deleted_at IS NULL AND ($1 OR user_id = $2)
+		GROUP BY status
 	`
 
-	rows, err := db.Conn.Query(query)
+	rows, err := db.QueryContext(ctx, query, isAdmin, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// GetTaskBoard retrieves a user's unarchived tasks for a board view, newest
+// first within each status, keeping at most perColumn tasks per status. The
+// rows come back ordered by status so callers can bucket them in one pass.
+func GetTaskBoard(ctx context.Context, db database.Querier, userID string, perColumn int) ([]*models.Task, error) {
+	query := `
+		SELECT ` + taskColumns + `
+		FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY status ORDER BY created_at DESC, id DESC) AS position
+			FROM tasks
+			WHERE user_id = $1 AND deleted_at IS NULL AND archived_at IS NULL
+		) ranked
+		WHERE position <= $2
+		ORDER BY status, created_at DESC, id DESC
+	`
+
+	rows, err := db.QueryContext(ctx, query, userID, perColumn)
 	if err != nil {
 		return nil, err
 	}
@@ -140,46 +1101,274 @@ func GetAllTasks(db *database.DB) ([]*models.Task, error) {
 
 	var tasks []*models.Task
 	for rows.Next() {
-		task := &models.Task{}
-		if err := rows.Scan(&task.ID, &task.UserID, &task.Title, &task.Description, &task.Status, &task.CreatedAt, &task.UpdatedAt); err != nil {
+		task, err := scanTask(rows)
+		if err != nil {
 			return nil, err
 		}
 		tasks = append(tasks, task)
 	}
 
-	return tasks, nil
+	return tasks, rows.Err()
 }
 
-// UpdateTask updates a task
-func UpdateTask(db *database.DB, task *models.Task) error {
+// GetUpcomingTasks returns up to limit of a user's open, unarchived tasks due
+// before the given time, overdue ones included, soonest due first
+func GetUpcomingTasks(ctx context.Context, db database.Querier, userID string, before time.Time, limit int) ([]*models.Task, error) {
 	query := `
-		UPDATE tasks
-		SET title = $1, description = $2, status = $3, updated_at = NOW()
-		WHERE id = $4
-		RETURNING updated_at
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE user_id = $1 AND status <> ALL($2) AND due_date < $3
+		AND deleted_at IS NULL AND archived_at IS NULL
+		ORDER BY due_date, id
+		LIMIT $4
 	`
 
-	row := db.Conn.QueryRow(query, task.Title, task.Description, task.Status, task.ID)
-	return row.Scan(&task.UpdatedAt)
+	rows, err := db.QueryContext(ctx, query, userID, pq.Array(models.ClosedStatuses), before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []*models.Task{}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
 }
 
-// DeleteTask deletes a task
-func DeleteTask(db *database.DB, taskID string) error {
-	query := `DELETE FROM tasks WHERE id = $1`
-	_, err := db.Conn.Exec(query, taskID)
-	return err
+// CountTasksByDay counts the tasks created and completed on each UTC day
+// from from to to inclusive, across all users. Both must be midnight UTC.
+// Every day in the range is returned, with zeros for days without activity.
+func CountTasksByDay(ctx context.Context, db database.Querier, from time.Time, to time.Time) ([]models.DailyTaskCount, error) {
+	query := `
+		WITH days AS (
+			SELECT generate_series($1::timestamptz, $2::timestamptz, INTERVAL '1 day') AS day
+		), created AS (
+			SELECT date_trunc('day', created_at) AS day, COUNT(*) AS count
+			FROM tasks
+			WHERE created_at >= $1 AND created_at < $2::timestamptz + INTERVAL '1 day'
+			GROUP BY 1
+		), completed AS (
+			SELECT date_trunc('day', changed_at) AS day, COUNT(*) AS count
+			FROM task_status_history
+			WHERE new_status = $3 AND changed_at >= $1 AND changed_at < $2::timestamptz + INTERVAL '1 day'
+			GROUP BY 1
+		)
+		SELECT days.day, COALESCE(created.count, 0), COALESCE(completed.count, 0)
+		FROM days
+		LEFT JOIN created ON created.day = days.day
+		LEFT JOIN completed ON completed.day = days.day
+		ORDER BY days.day
+	`
+
+	rows, err := db.QueryContext(ctx, query, from, to, models.StatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []models.DailyTaskCount
+	for rows.Next() {
+		var day time.Time
+		var count models.DailyTaskCount
+		if err := rows.Scan(&day, &count.Created, &count.Completed); err != nil {
+			return nil, err
+		}
+		count.Date = day.UTC().Format("2006-01-02")
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
+// AutoCompletedTask is a task completed by AutoCompleteDueTasks, with the
+// status it had before
+type AutoCompletedTask struct {
+	Task           *models.Task
+	PreviousStatus string
 }
 
-// GetTasksForAutoCompletion retrieves tasks that need auto-completion
-func GetTasksForAutoCompletion(db *database.DB, minutes int) ([]*models.Task, error) {
+// AutoCompleteDueTasks completes every task created more than minutes ago
+// that hasn't opted out of auto-completion and whose status the system may
+// move to completed (see models.CanTransition), in a single statement,
+// recording each change in the status history as "system". Rows locked by
+// another transaction are skipped and picked up by a later call.
+func AutoCompleteDueTasks(ctx context.Context, db database.Querier, minutes int) ([]AutoCompletedTask, error) {
 	query := `
-		SELECT id, user_id, title, description, status, created_at, updated_at
+		WITH due AS (
+			SELECT id AS due_id, status AS previous_status
+			FROM tasks
+			WHERE status = ANY($3)
+			AND auto_complete
+			AND deleted_at IS NULL
+			AND created_at < NOW() - INTERVAL '1 minute' * $1
+			FOR UPDATE SKIP LOCKED
+		), completed AS (
+			UPDATE tasks
+			SET status = $4, version = version + 1, updated_at = NOW()
+			FROM due
+			WHERE tasks.id = due.due_id
+			RETURNING ` + taskColumns + `, due.previous_status
+		), history AS (
+			INSERT INTO task_status_history (task_id, old_status, new_status, changed_by)
+			SELECT id, previous_status, $4, $2 FROM completed
+		)
+		SELECT ` + taskColumns + `, previous_status FROM completed
+	`
+
+	fromStatuses := models.StatusesLeadingTo(models.ActorSystem, models.StatusCompleted)
+	rows, err := db.QueryContext(ctx, query, minutes, models.ChangedBySystem, pq.Array(fromStatuses), models.StatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var completed []AutoCompletedTask
+	for rows.Next() {
+		var previousStatus string
+		task, err := scanTask(rows, &previousStatus)
+		if err != nil {
+			return nil, err
+		}
+		completed = append(completed, AutoCompletedTask{Task: task, PreviousStatus: previousStatus})
+	}
+
+	return completed, rows.Err()
+}
+
+// GetTasksForAutoCompletion retrieves, oldest first, the tasks that
+// AutoCompleteDueTasks would complete for the given age in minutes, without
+// changing or locking them
+func GetTasksForAutoCompletion(ctx context.Context, db database.Querier, minutes int) ([]*models.Task, error) {
+	query := `
+		SELECT ` + taskColumns + `
 		FROM tasks
-		WHERE status IN ('pending', 'in_progress')
+		WHERE status = ANY($2)
+		AND auto_complete
+		AND deleted_at IS NULL
 		AND created_at < NOW() - INTERVAL '1 minute' * $1
+		ORDER BY created_at, id
+	`
+
+	fromStatuses := models.StatusesLeadingTo(models.ActorSystem, models.StatusCompleted)
+	rows, err := db.QueryContext(ctx, query, minutes, pq.Array(fromStatuses))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []*models.Task{}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
+
+// purgeBatchSize is how many tasks PurgeCompletedTasks deletes per statement
+const purgeBatchSize = 1000
+
+// PurgeCompletedTasks permanently deletes tasks, including soft-deleted
+// ones, that were completed and last changed more than days ago. Recurring
+// tasks whose next occurrence hasn't been created yet are kept. Tasks are
+// deleted in batches of purgeBatchSize, each its own statement, so a large
+// purge never holds locks on many rows at once; rows locked by a request
+// are skipped. It stops between batches once ctx is done and returns the
+// number of tasks deleted.
+func PurgeCompletedTasks(ctx context.Context, db database.Querier, days int) (int64, error) {
+	query := `
+		DELETE FROM tasks
+		WHERE id IN (
+			SELECT id FROM tasks
+			WHERE status = $1
+			AND next_run_at IS NULL
+			AND updated_at < NOW() - INTERVAL '1 day' * $2
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+	`
+
+	var purged int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return purged, err
+		}
+
+		result, err := db.ExecContext(ctx, query, models.StatusCompleted, days, purgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return purged, err
+		}
+
+		purged += affected
+		if affected < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// RecordStatusChange appends an entry to a task's status history
+func RecordStatusChange(db database.Querier, taskID string, oldStatus string, newStatus string, changedBy string) error {
+	query := `
+		INSERT INTO task_status_history (task_id, old_status, new_status, changed_by)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	_, err := db.Exec(query, taskID, oldStatus, newStatus, changedBy)
+	return err
+}
+
+// GetTaskStatusHistory retrieves a task's status changes, newest first
+func GetTaskStatusHistory(db database.Querier, taskID string) ([]*models.TaskStatusChange, error) {
+	query := `
+		SELECT id, old_status, new_status, changed_by, changed_at
+		FROM task_status_history WHERE task_id = $1
+		ORDER BY changed_at DESC, id DESC
 	`
 
-	rows, err := db.Conn.Query(query, minutes)
+	rows, err := db.Query(query, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []*models.TaskStatusChange{}
+	for rows.Next() {
+		change := &models.TaskStatusChange{}
+		if err := rows.Scan(&change.ID, &change.OldStatus, &change.NewStatus, &change.ChangedBy, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+
+	return history, rows.Err()
+}
+
+// GetRecurringTasksDue retrieves completed recurring tasks whose next
+// occurrence is due to be created
+func GetRecurringTasksDue(db database.Querier) ([]*models.Task, error) {
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE status = $1
+		AND recurrence <> 'none'
+		AND next_run_at <= NOW()
+		AND deleted_at IS NULL
+	`
+
+	rows, err := db.Query(query, models.StatusCompleted)
 	if err != nil {
 		return nil, err
 	}
@@ -187,23 +1376,43 @@ func GetTasksForAutoCompletion(db *database.DB, minutes int) ([]*models.Task, er
 
 	var tasks []*models.Task
 	for rows.Next() {
-		task := &models.Task{}
-		if err := rows.Scan(&task.ID, &task.UserID, &task.Title, &task.Description, &task.Status, &task.CreatedAt, &task.UpdatedAt); err != nil {
+		task, err := scanTask(rows)
+		if err != nil {
 			return nil, err
 		}
 		tasks = append(tasks, task)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
 	return tasks, nil
 }
 
-// AutoCompleteTask marks a task as completed
-func AutoCompleteTask(db *database.DB, taskID string) error {
+// ClearTaskNextRun marks a recurring task's next occurrence as created
+func ClearTaskNextRun(db database.Querier, taskID string) error {
+	query := `UPDATE tasks SET next_run_at = NULL WHERE id = $1`
+	_, err := db.Exec(query, taskID)
+	return err
+}
+
+// AutoCompleteTask marks a task as completed and reports whether it changed.
+// Tasks that opted out of auto-completion are left alone.
+func AutoCompleteTask(db database.Querier, taskID string) (bool, error) {
 	query := `
 		UPDATE tasks
-		SET status = 'completed', updated_at = NOW()
-		WHERE id = $1 AND status IN ('pending', 'in_progress')
+		SET status = $3, version = version + 1, updated_at = NOW()
+		WHERE id = $1 AND status = ANY($2) AND auto_complete AND deleted_at IS NULL
 	`
-	_, err := db.Conn.Exec(query, taskID)
-	return err
+	fromStatuses := models.StatusesLeadingTo(models.ActorSystem, models.StatusCompleted)
+	result, err := db.Exec(query, taskID, pq.Array(fromStatuses), models.StatusCompleted)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
 }
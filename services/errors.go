@@ -0,0 +1,56 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"taskapi/repositories"
+)
+
+// Error kinds. Every error the services return for a client mistake wraps
+// one of these, so handlers can choose a status code with errors.Is instead
+// of matching messages. Any other error is an internal failure.
+var (
+	// ErrNotFound means the requested resource does not exist
+	ErrNotFound = repositories.ErrNotFound
+	// ErrUnauthorized means the caller's credentials were wrong
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden means the caller may not perform the operation
+	ErrForbidden = errors.New("forbidden")
+	// ErrValidation means the request itself is invalid
+	ErrValidation = errors.New("invalid request")
+	// ErrConflict means the request conflicts with the resource's current state
+	ErrConflict = errors.New("conflict")
+	// ErrRateLimited means the caller is acting too quickly and should retry later
+	ErrRateLimited = errors.New("rate limited")
+)
+
+// Error is a service error of one kind. Its message is meant for clients.
+type Error struct {
+	Kind    error
+	Message string
+	// Err is the underlying error, if any
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap exposes both the kind and the underlying error to errors.Is
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+// newError returns an Error of the given kind with a formatted message
+func newError(kind error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+// wrapError returns an Error of the given kind that keeps err's message and
+// still matches err
+func wrapError(kind error, err error) error {
+	return &Error{Kind: kind, Message: err.Error(), Err: err}
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"taskapi/config"
+	"taskapi/models"
+	"taskapi/repositories"
+	"time"
+)
+
+// testConfig returns the settings the services need, without reading the
+// environment
+func testConfig() *config.Config {
+	return &config.Config{
+		JWTSecret:            "test-secret-that-is-at-least-32-chars",
+		JWTExpiryHours:       1,
+		BcryptCost:           4,
+		MaxDescriptionLength: config.MaxDescriptionLengthLimit,
+	}
+}
+
+// fakeTaskRepo is an in-memory TaskRepository. Only the methods the tests
+// exercise are implemented; calling any other panics on the nil embedded
+// interface.
+type fakeTaskRepo struct {
+	repositories.TaskRepository
+
+	mu      sync.Mutex
+	tasks   map[string]*models.Task
+	writes  int // UpdateTask and ReassignTask calls that changed a row
+	history []statusChange
+}
+
+// statusChange is a status history entry recorded by fakeTaskRepo
+type statusChange struct {
+	taskID, oldStatus, newStatus, changedBy string
+}
+
+func newFakeTaskRepo(tasks ...*models.Task) *fakeTaskRepo {
+	r := &fakeTaskRepo{tasks: make(map[string]*models.Task)}
+	for _, task := range tasks {
+		r.tasks[task.ID] = task
+	}
+	return r
+}
+
+// copyTask returns a copy so callers can't change the stored task
+func copyTask(task *models.Task) *models.Task {
+	c := *task
+	c.Tags = append([]string(nil), task.Tags...)
+	return &c
+}
+
+func (r *fakeTaskRepo) get(taskID string) (*models.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	task, ok := r.tasks[taskID]
+	if !ok {
+		return nil, repositories.ErrTaskNotFound
+	}
+	return copyTask(task), nil
+}
+
+func (r *fakeTaskRepo) GetTaskByID(taskID string) (*models.Task, error) {
+	return r.get(taskID)
+}
+
+func (r *fakeTaskRepo) GetTaskWithOwner(taskID string) (*models.Task, error) {
+	task, err := r.get(taskID)
+	if err != nil {
+		return nil, err
+	}
+	task.Owner = &models.TaskOwner{ID: task.UserID, Username: "owner", Email: "owner@example.com"}
+	return task, nil
+}
+
+func (r *fakeTaskRepo) GetTaskByIDForUpdate(taskID string) (*models.Task, error) {
+	return r.get(taskID)
+}
+
+func (r *fakeTaskRepo) UpdateTask(task *models.Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.tasks[task.ID]
+	if !ok || stored.Version != task.Version {
+		return repositories.ErrVersionConflict
+	}
+	task.Version++
+	task.UpdatedAt = time.Now()
+	r.tasks[task.ID] = copyTask(task)
+	r.writes++
+	return nil
+}
+
+func (r *fakeTaskRepo) ReassignTask(taskID string, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tasks[taskID].UserID = userID
+	r.writes++
+	return nil
+}
+
+func (r *fakeTaskRepo) RecordStatusChange(taskID string, oldStatus string, newStatus string, changedBy string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.history = append(r.history, statusChange{taskID, oldStatus, newStatus, changedBy})
+	return nil
+}
+
+func (r *fakeTaskRepo) GetUserTasks(userID string, filter models.TaskFilter) ([]*models.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var tasks []*models.Task
+	for _, task := range r.tasks {
+		if task.UserID == userID && len(tasks) < filter.Limit {
+			tasks = append(tasks, copyTask(task))
+		}
+	}
+	return tasks, nil
+}
+
+func (r *fakeTaskRepo) GetAllTasks(filter models.TaskFilter) ([]*models.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var tasks []*models.Task
+	for _, task := range r.tasks {
+		if len(tasks) < filter.Limit {
+			c := copyTask(task)
+			c.Owner = &models.TaskOwner{ID: task.UserID, Username: "owner", Email: "owner@example.com"}
+			tasks = append(tasks, c)
+		}
+	}
+	return tasks, nil
+}
+
+// The fake has no transactions; fn runs against the repository itself
+func (r *fakeTaskRepo) WithTx(ctx context.Context, fn func(tasks repositories.TaskRepository) error) error {
+	return fn(r)
+}
+
+func (r *fakeTaskRepo) WithRetryTx(ctx context.Context, fn func(tasks repositories.TaskRepository) error) error {
+	return fn(r)
+}
+
+// fakeUserRepo is an in-memory UserRepository, implemented as far as the
+// tests need
+type fakeUserRepo struct {
+	repositories.UserRepository
+
+	mu    sync.Mutex
+	users map[string]*models.User
+}
+
+func newFakeUserRepo(users ...*models.User) *fakeUserRepo {
+	r := &fakeUserRepo{users: make(map[string]*models.User)}
+	for _, user := range users {
+		r.users[user.ID] = user
+	}
+	return r
+}
+
+func (r *fakeUserRepo) CreateUser(user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.users {
+		if existing.Email == user.Email {
+			return repositories.ErrEmailTaken
+		}
+	}
+	user.ID = fmt.Sprintf("00000000-0000-0000-0000-%012d", len(r.users)+1)
+	user.CreatedAt = time.Now()
+	stored := *user
+	r.users[user.ID] = &stored
+	return nil
+}
+
+func (r *fakeUserRepo) GetUserByID(id string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return nil, repositories.ErrUserNotFound
+	}
+	c := *user
+	return &c, nil
+}
+
+func (r *fakeUserRepo) CreateEmailVerification(userID string, tokenHash string, expiresAt time.Time) error {
+	return nil
+}
+
+func (r *fakeUserRepo) WithTx(ctx context.Context, fn func(users repositories.UserRepository) error) error {
+	return fn(r)
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"golang.org/x/time/rate"
+	"sync"
+	"time"
+)
+
+// RateLimitError is returned when a user creates tasks faster than
+// TASK_CREATE_RATE_PER_MINUTE allows. RetryAfter is how long until the
+// request would succeed.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return "task creation rate limit exceeded"
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// creationLimiterTTL is how long an idle user's limiter is kept. A bucket
+// left alone this long has refilled completely, so dropping it loses nothing.
+const creationLimiterTTL = 2 * time.Minute
+
+// userLimiter tracks a user's token bucket and when it was last used
+type userLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// creationLimiter holds per-user token buckets for task creation. Each user
+// may create perMinute tasks in a burst, refilled evenly over a minute.
+type creationLimiter struct {
+	mu        sync.Mutex
+	users     map[string]*userLimiter
+	perMinute int
+}
+
+// newCreationLimiter creates a limiter and starts its cleanup goroutine. It
+// returns nil when perMinute is zero, which disables the limit.
+func newCreationLimiter(perMinute int) *creationLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+
+	l := &creationLimiter{
+		users:     make(map[string]*userLimiter),
+		perMinute: perMinute,
+	}
+	go l.cleanup()
+	return l
+}
+
+// allow takes n tokens from the user's bucket, or returns a *RateLimitError
+// without taking any if there aren't enough. A nil limiter allows everything.
+func (l *creationLimiter) allow(userID string, n int) error {
+	if l == nil {
+		return nil
+	}
+	if n > l.perMinute {
+		return newError(ErrValidation, "cannot create more than %d tasks per minute", l.perMinute)
+	}
+
+	l.mu.Lock()
+	user, exists := l.users[userID]
+	if !exists {
+		user = &userLimiter{limiter: rate.NewLimiter(rate.Every(time.Minute/time.Duration(l.perMinute)), l.perMinute)}
+		l.users[userID] = user
+	}
+	user.lastSeen = time.Now()
+	l.mu.Unlock()
+
+	reservation := user.limiter.ReserveN(time.Now(), n)
+	if delay := reservation.Delay(); delay > 0 {
+		reservation.Cancel()
+		return &RateLimitError{RetryAfter: delay}
+	}
+	return nil
+}
+
+// cleanup periodically removes limiters that have not been used recently
+func (l *creationLimiter) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		l.mu.Lock()
+		for userID, user := range l.users {
+			if time.Since(user.lastSeen) > creationLimiterTTL {
+				delete(l.users, userID)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// checkCreationRate fails with a *RateLimitError if the user may not create
+// n more tasks yet. Admins are exempt.
+func (s *TaskService) checkCreationRate(userID string, n int, isAdmin bool) error {
+	if isAdmin {
+		return nil
+	}
+	return s.creations.allow(userID, n)
+}
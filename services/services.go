@@ -1,46 +1,66 @@
 package services
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"net/mail"
+	"slices"
+	"sort"
+	"strings"
 	"taskapi/config"
-	"taskapi/database"
+	"taskapi/events"
+	"taskapi/metrics"
 	"taskapi/middleware"
 	"taskapi/models"
 	"taskapi/repositories"
+	"taskapi/webhook"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // UserService handles user-related business logic
 type UserService struct {
-	db  *database.DB
-	cfg *config.Config
+	users repositories.UserRepository
+	cfg   *config.Config
 }
 
 // NewUserService creates a new user service
-func NewUserService(db *database.DB, cfg *config.Config) *UserService {
-	return &UserService{db: db, cfg: cfg}
+func NewUserService(users repositories.UserRepository, cfg *config.Config) *UserService {
+	return &UserService{users: users, cfg: cfg}
 }
 
 // Register creates a new user
-func (s *UserService) Register(req *models.RegisterRequest) (*models.AuthResponse, error) {
-	if req.Email == "" || req.Username == "" || req.Password == "" {
-		return nil, errors.New("email, username, and password are required")
+func (s *UserService) Register(ctx context.Context, req *models.RegisterRequest) (*models.AuthResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), s.cfg.BcryptCost)
 	if err != nil {
 		return nil, err
 	}
 
 	user := &models.User{
 		Email:    req.Email,
-		Username: req.Username,
+		Username: strings.TrimSpace(req.Username),
 		Password: string(hashedPassword),
-		Role:     "user",
+		Role:     models.RoleUser,
 	}
 
-	if err := repositories.CreateUser(s.db, user); err != nil {
-		return nil, errors.New("user already exists or database error")
+	err = s.users.WithTx(ctx, func(users repositories.UserRepository) error {
+		if err := users.CreateUser(user); err != nil {
+			return userConflictError(err)
+		}
+		return s.issueEmailVerification(ctx, users, user.ID)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	token, err := middleware.GenerateToken(user, s.cfg)
@@ -57,19 +77,46 @@ func (s *UserService) Register(req *models.RegisterRequest) (*models.AuthRespons
 	}, nil
 }
 
+// userConflictError marks a clash with another user's email or username as
+// a conflict
+func userConflictError(err error) error {
+	if errors.Is(err, repositories.ErrEmailTaken) || errors.Is(err, repositories.ErrUsernameTaken) || errors.Is(err, repositories.ErrUserExists) {
+		return wrapError(ErrConflict, err)
+	}
+	return err
+}
+
+// taskConflictError marks a clash with another of the user's task titles,
+// when UNIQUE_TASK_TITLES_PER_USER is enabled, as a conflict
+func taskConflictError(err error) error {
+	if errors.Is(err, repositories.ErrDuplicateTaskTitle) {
+		return wrapError(ErrConflict, err)
+	}
+	return err
+}
+
 // Login authenticates a user
 func (s *UserService) Login(req *models.LoginRequest) (*models.AuthResponse, error) {
-	if req.Email == "" || req.Password == "" {
-		return nil, errors.New("email and password are required")
+	if err := validateRequest(req); err != nil {
+		return nil, err
 	}
 
-	user, err := repositories.GetUserByEmail(s.db, req.Email)
+	user, err := s.users.GetUserByEmail(req.Email)
+	if errors.Is(err, repositories.ErrUserNotFound) {
+		return nil, newError(ErrUnauthorized, "invalid email or password")
+	}
 	if err != nil {
-		return nil, errors.New("invalid email or password")
+		return nil, err
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		return nil, errors.New("invalid email or password")
+		return nil, newError(ErrUnauthorized, "invalid email or password")
+	}
+
+	// Best effort: failing to record the login must not fail it. The
+	// response keeps the previous value, so it shows the login before this.
+	if err := s.users.TouchLastLogin(user.ID); err != nil {
+		slog.Warn("Failed to record last login", "user_id", user.ID, "error", err)
 	}
 
 	token, err := middleware.GenerateToken(user, s.cfg)
@@ -86,63 +133,965 @@ func (s *UserService) Login(req *models.LoginRequest) (*models.AuthResponse, err
 	}, nil
 }
 
+// ForgotPassword issues a single-use reset token for the account with the
+// given email. It succeeds whether or not the account exists so callers
+// can't probe for registered emails.
+func (s *UserService) ForgotPassword(ctx context.Context, req *models.ForgotPasswordRequest) error {
+	if req.Email == "" {
+		return newError(ErrValidation, "email is required")
+	}
+
+	user, err := s.users.GetUserByEmail(req.Email)
+	if err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := newSecretToken()
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().UTC().Add(time.Duration(s.cfg.PasswordResetTTLMinutes) * time.Minute)
+	if err := s.users.CreatePasswordReset(user.ID, hashToken(token), expiresAt); err != nil {
+		return err
+	}
+
+	// There is no mail integration yet; the token would be emailed here.
+	// Only development logs it so the flow can be exercised locally.
+	if s.cfg.IsDevelopment() {
+		slog.InfoContext(ctx, "Password reset token issued", "user_id", user.ID, "token", token)
+	} else {
+		slog.InfoContext(ctx, "Password reset token issued", "user_id", user.ID)
+	}
+	return nil
+}
+
+// issueEmailVerification stores a new single-use verification token for a
+// user's current email address
+func (s *UserService) issueEmailVerification(ctx context.Context, users repositories.UserRepository, userID string) error {
+	token, err := newSecretToken()
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().UTC().Add(time.Duration(s.cfg.EmailVerificationTTLHours) * time.Hour)
+	if err := users.CreateEmailVerification(userID, hashToken(token), expiresAt); err != nil {
+		return err
+	}
+
+	// As with password resets, the token would be emailed here. Only
+	// development logs it so the flow can be exercised locally.
+	if s.cfg.IsDevelopment() {
+		slog.InfoContext(ctx, "Email verification token issued", "user_id", userID, "token", token)
+	} else {
+		slog.InfoContext(ctx, "Email verification token issued", "user_id", userID)
+	}
+	return nil
+}
+
+// VerifyEmail marks a user's email as verified using a verification token,
+// then invalidates any other tokens outstanding for the user
+func (s *UserService) VerifyEmail(ctx context.Context, token string) error {
+	if token == "" {
+		return newError(ErrValidation, "token is required")
+	}
+
+	return s.users.WithTx(ctx, func(users repositories.UserRepository) error {
+		userID, err := users.ConsumeEmailVerification(hashToken(token))
+		if errors.Is(err, repositories.ErrInvalidVerificationToken) {
+			return wrapError(ErrValidation, err)
+		}
+		if err != nil {
+			return err
+		}
+		if err := users.MarkEmailVerified(userID); err != nil {
+			return err
+		}
+		return users.InvalidateEmailVerifications(userID)
+	})
+}
+
+// ResendEmailVerification replaces a user's outstanding verification tokens
+// with a new one
+func (s *UserService) ResendEmailVerification(ctx context.Context, userID string) error {
+	return s.users.WithTx(ctx, func(users repositories.UserRepository) error {
+		user, err := users.GetUserByID(userID)
+		if err != nil {
+			return err
+		}
+		if user.EmailVerified {
+			return newError(ErrConflict, "email is already verified")
+		}
+		if err := users.InvalidateEmailVerifications(userID); err != nil {
+			return err
+		}
+		return s.issueEmailVerification(ctx, users, userID)
+	})
+}
+
+// IsEmailVerified reports whether a user has verified their email address
+func (s *UserService) IsEmailVerified(ctx context.Context, userID string) (bool, error) {
+	user, err := s.users.GetUserByID(userID)
+	if err != nil {
+		return false, err
+	}
+	return user.EmailVerified, nil
+}
+
+// ResetPassword sets a new password using a reset token, then invalidates
+// that token and any others outstanding for the user
+func (s *UserService) ResetPassword(ctx context.Context, req *models.ResetPasswordRequest) error {
+	if req.Token == "" || req.NewPassword == "" {
+		return newError(ErrValidation, "token and new_password are required")
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), s.cfg.BcryptCost)
+	if err != nil {
+		return err
+	}
+
+	return s.users.WithTx(ctx, func(users repositories.UserRepository) error {
+		userID, err := users.ConsumePasswordReset(hashToken(req.Token))
+		if errors.Is(err, repositories.ErrInvalidResetToken) {
+			return wrapError(ErrValidation, err)
+		}
+		if err != nil {
+			return err
+		}
+		if err := users.UpdateUserPassword(userID, string(hashedPassword)); err != nil {
+			return err
+		}
+		return users.InvalidatePasswordResets(userID)
+	})
+}
+
+// apiKeyPrefix marks API keys so they are recognisable in configs and logs
+const apiKeyPrefix = "tk_"
+
+// maxAPIKeyLabelLength matches the api_keys.label column
+const maxAPIKeyLabelLength = 255
+
+// CreateAPIKey issues a new API key for a user. The plaintext key is only
+// returned here; just its hash is stored.
+func (s *UserService) CreateAPIKey(userID string, req *models.CreateAPIKeyRequest) (*models.CreateAPIKeyResponse, error) {
+	if len(req.Label) > maxAPIKeyLabelLength {
+		return nil, newError(ErrValidation, "label must be at most %d characters", maxAPIKeyLabelLength)
+	}
+
+	token, err := newSecretToken()
+	if err != nil {
+		return nil, err
+	}
+	key := apiKeyPrefix + token
+
+	apiKey := models.APIKey{Label: req.Label}
+	if err := s.users.CreateAPIKey(userID, hashToken(key), &apiKey); err != nil {
+		return nil, err
+	}
+
+	return &models.CreateAPIKeyResponse{APIKey: apiKey, Key: key}, nil
+}
+
+// ListAPIKeys lists a user's API keys without the secret values
+func (s *UserService) ListAPIKeys(userID string) ([]*models.APIKey, error) {
+	return s.users.GetUserAPIKeys(userID)
+}
+
+// RevokeAPIKey deletes one of a user's API keys
+func (s *UserService) RevokeAPIKey(userID string, keyID string) error {
+	return s.users.DeleteAPIKey(keyID, userID)
+}
+
+// ResolveAPIKey returns the user that owns an API key, so AuthMiddleware can
+// authenticate X-API-Key requests with the owner's current role
+func (s *UserService) ResolveAPIKey(ctx context.Context, key string) (*models.User, error) {
+	return s.users.GetUserByAPIKey(hashToken(key))
+}
+
+// newSecretToken returns 32 random bytes, hex encoded
+func newSecretToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// hashToken returns the hex SHA-256 of a secret token. Only the hash is
+// stored, so a database leak doesn't expose usable tokens.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// User list page sizes
+const (
+	defaultUserPageSize = 20
+	maxUserPageSize     = 100
+)
+
+// ListUsers retrieves a page of users matching the filter, with the total
+// number of matches (for admin). The limit defaults to 20 and is capped at 100.
+func (s *UserService) ListUsers(ctx context.Context, filter models.UserFilter) (*models.UserPage, error) {
+	if err := repositories.ValidateUserSort(filter.Sort); err != nil {
+		return nil, &FilterError{err.Error()}
+	}
+	if filter.Limit < 0 {
+		return nil, &FilterError{"limit must be greater than zero"}
+	}
+	if filter.Offset < 0 {
+		return nil, &FilterError{"offset must not be negative"}
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultUserPageSize
+	}
+	if filter.Limit > maxUserPageSize {
+		filter.Limit = maxUserPageSize
+	}
+
+	users, err := s.users.GetUsers(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	total, err := s.users.CountUsers(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		user.Password = ""
+	}
+	return &models.UserPage{Users: users, Limit: filter.Limit, Offset: filter.Offset, Total: total}, nil
+}
+
+// GetUser retrieves a user by ID (for admin)
+func (s *UserService) GetUser(userID string) (*models.User, error) {
+	user, err := s.users.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = ""
+	return user, nil
+}
+
+// Impersonate issues a short-lived token that lets an admin act as another
+// user, for example to reproduce what they see. Other admins can't be
+// impersonated. Every issue is logged.
+func (s *UserService) Impersonate(ctx context.Context, adminID string, userID string) (*models.AuthResponse, error) {
+	if adminID == userID {
+		return nil, newError(ErrValidation, "admins cannot impersonate themselves")
+	}
+
+	user, err := s.users.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	// An admin token would reach the admin routes, including this one
+	if user.Role == models.RoleAdmin {
+		return nil, newError(ErrForbidden, "admins cannot be impersonated")
+	}
+
+	token, err := middleware.GenerateImpersonationToken(user, adminID, s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Issued impersonation token", "admin_id", adminID, "user_id", userID, "expires_in_minutes", s.cfg.ImpersonationTokenMinutes)
+
+	user.Password = ""
+	return &models.AuthResponse{
+		Token: token,
+		User:  *user,
+	}, nil
+}
+
+// DeleteUser deletes a user and their tasks (for admin)
+func (s *UserService) DeleteUser(adminID string, userID string) error {
+	if adminID == userID {
+		return newError(ErrValidation, "admins cannot delete themselves")
+	}
+
+	return s.users.DeleteUser(userID)
+}
+
+// DeleteAccount deletes the caller's own account and, through the foreign
+// key cascade, all of their tasks. The current password must be supplied as
+// confirmation, and the last remaining admin can't delete itself.
+func (s *UserService) DeleteAccount(ctx context.Context, userID string, req *models.DeleteAccountRequest) error {
+	if req.Password == "" {
+		return newError(ErrValidation, "password is required")
+	}
+
+	return s.users.WithTx(ctx, func(users repositories.UserRepository) error {
+		if err := users.LockAdmins(); err != nil {
+			return err
+		}
+
+		user, err := users.GetUserByID(userID)
+		if err != nil {
+			return err
+		}
+
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+			return newError(ErrUnauthorized, "invalid password")
+		}
+
+		if user.Role == models.RoleAdmin {
+			count, err := users.CountAdmins()
+			if err != nil {
+				return err
+			}
+			if count <= 1 {
+				return newError(ErrConflict, "cannot delete the last remaining admin")
+			}
+		}
+
+		return users.DeleteUser(userID)
+	})
+}
+
+// Limits on profile fields, matching the users table columns
+const (
+	maxEmailLength    = 255
+	maxUsernameLength = 255
+)
+
+// validateEmail trims an email address and checks it is a single plain
+// address within the length limit
+func validateEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if utf8.RuneCountInString(email) > maxEmailLength {
+		return "", newError(ErrValidation, "email must be at most %d characters", maxEmailLength)
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", newError(ErrValidation, "invalid email address")
+	}
+	return email, nil
+}
+
+// validateUsername trims a username and checks it is present, within the
+// length limit and free of whitespace
+func validateUsername(username string) (string, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return "", newError(ErrValidation, "username is required")
+	}
+	if utf8.RuneCountInString(username) > maxUsernameLength {
+		return "", newError(ErrValidation, "username must be at most %d characters", maxUsernameLength)
+	}
+	if strings.IndexFunc(username, unicode.IsSpace) >= 0 {
+		return "", newError(ErrValidation, "username must not contain whitespace")
+	}
+	return username, nil
+}
+
+// UpdateProfile changes the caller's email and/or username and returns the
+// updated user with a new token, since the caller's current token still
+// carries the old values
+func (s *UserService) UpdateProfile(ctx context.Context, userID string, req *models.UpdateProfileRequest) (*models.AuthResponse, error) {
+	if req.Email == "" && req.Username == "" {
+		return nil, newError(ErrValidation, "email or username is required")
+	}
+
+	var email, username string
+	if req.Email != "" {
+		var err error
+		if email, err = validateEmail(req.Email); err != nil {
+			return nil, err
+		}
+	}
+	if req.Username != "" {
+		var err error
+		if username, err = validateUsername(req.Username); err != nil {
+			return nil, err
+		}
+	}
+
+	var user *models.User
+	err := s.users.WithTx(ctx, func(users repositories.UserRepository) error {
+		current, err := users.GetUserByID(userID)
+		if err != nil {
+			return err
+		}
+		if email == "" {
+			email = current.Email
+		}
+		if username == "" {
+			username = current.Username
+		}
+
+		user, err = users.UpdateUserProfile(userID, email, username)
+		if err != nil {
+			return userConflictError(err)
+		}
+
+		// A new address has to be verified again
+		if user.Email != current.Email {
+			if err := users.InvalidateEmailVerifications(userID); err != nil {
+				return err
+			}
+			return s.issueEmailVerification(ctx, users, userID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := middleware.GenerateToken(user, s.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthResponse{
+		Token: token,
+		User:  *user,
+	}, nil
+}
+
+// UpdateUserRole changes a user's role (for admin). The admin count check and
+// the update run in one transaction with admin rows locked.
+func (s *UserService) UpdateUserRole(ctx context.Context, userID string, role string) (*models.User, error) {
+	if !models.ValidRole(role) {
+		return nil, newError(ErrValidation, "invalid role")
+	}
+
+	var user *models.User
+	err := s.users.WithTx(ctx, func(users repositories.UserRepository) error {
+		if err := users.LockAdmins(); err != nil {
+			return err
+		}
+
+		var err error
+		user, err = users.GetUserByID(userID)
+		if err != nil {
+			return err
+		}
+
+		// Don't allow demoting the last remaining admin
+		if user.Role == models.RoleAdmin && role != models.RoleAdmin {
+			count, err := users.CountAdmins()
+			if err != nil {
+				return err
+			}
+			if count <= 1 {
+				return newError(ErrConflict, "cannot demote the last remaining admin")
+			}
+		}
+
+		return users.UpdateUserRole(userID, role)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user.Role = role
+	user.Password = ""
+	return user, nil
+}
+
 // TaskService handles task-related business logic
 type TaskService struct {
-	db *database.DB
+	tasks    repositories.TaskRepository
+	users    repositories.UserRepository
+	cfg      *config.Config
+	notifier *webhook.Notifier
+	hub      *events.Hub
+	// creations is nil when TASK_CREATE_RATE_PER_MINUTE is zero
+	creations *creationLimiter
 }
 
 // NewTaskService creates a new task service
-func NewTaskService(db *database.DB) *TaskService {
-	return &TaskService{db: db}
+func NewTaskService(tasks repositories.TaskRepository, users repositories.UserRepository, cfg *config.Config, notifier *webhook.Notifier, hub *events.Hub) *TaskService {
+	return &TaskService{
+		tasks:     tasks,
+		users:     users,
+		cfg:       cfg,
+		notifier:  notifier,
+		hub:       hub,
+		creations: newCreationLimiter(cfg.TaskCreateRatePerMinute),
+	}
 }
 
-// CreateTask creates a new task for a user
-func (s *TaskService) CreateTask(userID string, req *models.CreateTaskRequest) (*models.Task, error) {
-	if req.Title == "" {
-		return nil, errors.New("title is required")
+// ErrQuotaExceeded is returned when creating tasks would take a user past
+// MAX_TASKS_PER_USER open tasks
+var ErrQuotaExceeded = newError(ErrForbidden, "task quota exceeded")
+
+// checkQuota fails with ErrQuotaExceeded if adding n tasks would put the user
+// over the configured limit. Admins and a zero limit are unrestricted. tasks
+// must be bound to the transaction that performs the insert.
+func (s *TaskService) checkQuota(ctx context.Context, tasks repositories.TaskRepository, userID string, n int, isAdmin bool) error {
+	if isAdmin || s.cfg.MaxTasksPerUser <= 0 {
+		return nil
+	}
+
+	count, err := tasks.CountActiveTasksLocked(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if count+n > s.cfg.MaxTasksPerUser {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// normalizeTags trims validated tags and drops duplicates. It always
+// returns a non-nil slice so tasks serialize "tags": [].
+func normalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
 	}
+	return normalized
+}
 
+// newTask builds a pending task for userID from a validated create request,
+// trimming its text and scheduling its recurrence
+func newTask(userID string, req *models.CreateTaskRequest) *models.Task {
 	task := &models.Task{
-		UserID:      userID,
-		Title:       req.Title,
-		Description: req.Description,
-		Status:      "pending",
+		UserID:       userID,
+		Title:        strings.TrimSpace(req.Title),
+		Description:  strings.TrimSpace(req.Description),
+		Status:       models.StatusPending,
+		Tags:         normalizeTags(req.Tags),
+		DueDate:      utcTime(req.DueDate),
+		AutoComplete: autoCompleteOrDefault(req.AutoComplete),
 	}
+	scheduleRecurrence(task, req.Recurrence)
+	return task
+}
 
-	if err := repositories.CreateTask(s.db, task); err != nil {
+// scheduleRecurrence sets the task's rule, which must already be valid, and
+// next run time. The next occurrence follows the due date, or now when the
+// task has none. An empty rule means no recurrence.
+func scheduleRecurrence(task *models.Task, rule string) {
+	if rule == "" {
+		rule = models.RecurrenceNone
+	}
+
+	task.Recurrence = rule
+	task.NextRunAt = nil
+	if rule != models.RecurrenceNone {
+		base := time.Now().UTC()
+		if task.DueDate != nil {
+			base = *task.DueDate
+		}
+		next := models.NextOccurrence(rule, base)
+		task.NextRunAt = &next
+	}
+}
+
+// autoCompleteOrDefault returns a new task's auto-complete setting, which
+// is on unless the request turns it off
+func autoCompleteOrDefault(autoComplete *bool) bool {
+	return autoComplete == nil || *autoComplete
+}
+
+// utcTime converts a client-supplied time to UTC so every timestamp the API
+// stores and returns is in one zone
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// CreateTask creates a new task for a user
+func (s *TaskService) CreateTask(ctx context.Context, userID string, req *models.CreateTaskRequest, isAdmin bool) (*models.Task, error) {
+	if err := s.validateTaskRequest(req, req.Description); err != nil {
+		return nil, err
+	}
+	if err := s.checkCreationRate(userID, 1, isAdmin); err != nil {
 		return nil, err
 	}
+	task := newTask(userID, req)
+
+	err := s.tasks.WithTx(ctx, func(tasks repositories.TaskRepository) error {
+		if err := s.checkQuota(ctx, tasks, userID, 1, isAdmin); err != nil {
+			return err
+		}
+		return tasks.CreateTask(task)
+	})
+	if err != nil {
+		return nil, taskConflictError(err)
+	}
+	metrics.TasksCreatedTotal.Inc()
 
 	// Don't expose UserID in response
 	task.UserID = ""
 	return task, nil
 }
 
-// GetTask retrieves a task by ID
-func (s *TaskService) GetTask(taskID string) (*models.Task, error) {
-	task, err := repositories.GetTaskByID(s.db, taskID)
+// CreateTaskIdempotent creates a task unless the idempotency key was already
+// used, in which case the originally created task is returned with replayed=true
+func (s *TaskService) CreateTaskIdempotent(ctx context.Context, userID string, key string, req *models.CreateTaskRequest, isAdmin bool) (*models.Task, bool, error) {
+	if err := s.validateTaskRequest(req, req.Description); err != nil {
+		return nil, false, err
+	}
+	if len(key) > 255 {
+		return nil, false, newError(ErrValidation, "idempotency key is too long")
+	}
+	task := newTask(userID, req)
+
+	var existingID string
+	err := s.tasks.WithTx(ctx, func(tasks repositories.TaskRepository) error {
+		id, claimed, err := tasks.ClaimIdempotencyKey(ctx, userID, key, s.cfg.IdempotencyKeyTTLHours)
+		if errors.Is(err, repositories.ErrIdempotentTaskGone) {
+			return wrapError(ErrConflict, err)
+		}
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			// A replay doesn't create anything, so it isn't subject to the
+			// quota or the creation rate limit
+			existingID = id
+			return nil
+		}
+
+		if err := s.checkCreationRate(userID, 1, isAdmin); err != nil {
+			return err
+		}
+		if err := s.checkQuota(ctx, tasks, userID, 1, isAdmin); err != nil {
+			return err
+		}
+		if err := tasks.CreateTask(task); err != nil {
+			return err
+		}
+		return tasks.SetIdempotencyKeyTask(ctx, userID, key, task.ID)
+	})
+	if err != nil {
+		return nil, false, taskConflictError(err)
+	}
+
+	if existingID != "" {
+		task, err = s.tasks.GetTaskByID(existingID)
+		if err != nil {
+			return nil, false, err
+		}
+		task.UserID = ""
+		return task, true, nil
+	}
+	metrics.TasksCreatedTotal.Inc()
+
+	task.UserID = ""
+	return task, false, nil
+}
+
+// maxBulkTasks caps how many tasks can be created in one bulk request
+const maxBulkTasks = 100
+
+// BulkValidationError is returned when one or more bulk items are invalid
+type BulkValidationError struct {
+	Items []models.BulkItemError
+}
+
+func (e *BulkValidationError) Error() string {
+	return "one or more tasks are invalid"
+}
+
+func (e *BulkValidationError) Unwrap() error {
+	return ErrValidation
+}
+
+// CreateTasks creates several tasks for a user atomically
+func (s *TaskService) CreateTasks(ctx context.Context, userID string, reqs []models.CreateTaskRequest, isAdmin bool) ([]*models.Task, error) {
+	if len(reqs) == 0 {
+		return nil, newError(ErrValidation, "at least one task is required")
+	}
+	if len(reqs) > maxBulkTasks {
+		return nil, newError(ErrValidation, "cannot create more than %d tasks at once", maxBulkTasks)
+	}
+
+	// Validate every item before touching the database
+	var itemErrors []models.BulkItemError
+	tasks := make([]*models.Task, len(reqs))
+	for i := range reqs {
+		if err := s.validateTaskRequest(&reqs[i], reqs[i].Description); err != nil {
+			itemErrors = append(itemErrors, models.BulkItemError{Index: i, Error: err.Error()})
+			continue
+		}
+		tasks[i] = newTask(userID, &reqs[i])
+	}
+	if len(itemErrors) > 0 {
+		return nil, &BulkValidationError{Items: itemErrors}
+	}
+	if err := s.checkCreationRate(userID, len(tasks), isAdmin); err != nil {
+		return nil, err
+	}
+
+	err := s.tasks.WithTx(ctx, func(txTasks repositories.TaskRepository) error {
+		if err := s.checkQuota(ctx, txTasks, userID, len(tasks), isAdmin); err != nil {
+			return err
+		}
+		return txTasks.CreateTasksBatch(ctx, userID, tasks)
+	})
+	if err != nil {
+		return nil, taskConflictError(err)
+	}
+	metrics.TasksCreatedTotal.Add(float64(len(tasks)))
+
+	for _, task := range tasks {
+		task.UserID = ""
+	}
+	return tasks, nil
+}
+
+// GetTask retrieves a task by ID. Only the task's owner or a caller with read
+// access to all tasks (admins and viewers) may view it; the latter always get
+// the task's owner, with the email for admins only. The owner gets it,
+// without the email, when includeOwner is set.
+func (s *TaskService) GetTask(userID string, taskID string, isAdmin bool, isViewer bool, includeOwner bool) (*models.Task, error) {
+	if isAdmin || isViewer {
+		task, err := s.tasks.GetTaskWithOwner(taskID)
+		if err != nil {
+			return nil, err
+		}
+		task.UserID = ""
+		if !isAdmin {
+			hideOwnerEmail(task)
+		}
+		return task, nil
+	}
+
+	get := s.tasks.GetTaskByID
+	if includeOwner {
+		get = s.tasks.GetTaskWithOwner
+	}
+	task, err := get(taskID)
 	if err != nil {
 		return nil, err
 	}
+
+	// Check ownership before the owner is stripped from the response, so
+	// include=owner never reveals who owns someone else's task
+	if task.UserID != userID {
+		return nil, newError(ErrForbidden, "unauthorized to access this task")
+	}
+
 	task.UserID = ""
+	hideOwnerEmail(task)
 	return task, nil
 }
 
-// GetUserTasks retrieves all tasks for a user
-func (s *TaskService) GetUserTasks(userID string) ([]*models.Task, error) {
-	tasks, err := repositories.GetUserTasks(s.db, userID)
+// hideOwnerEmail removes the owner's email from a task shown to a non-admin
+func hideOwnerEmail(task *models.Task) {
+	if task.Owner != nil {
+		task.Owner.Email = ""
+	}
+}
+
+// GetTaskHistory retrieves a task's status history, newest first. Only the
+// task's owner, an admin or a viewer may view it.
+func (s *TaskService) GetTaskHistory(userID string, taskID string, isAdmin bool) ([]*models.TaskStatusChange, error) {
+	task, err := s.tasks.GetTaskByID(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isAdmin && task.UserID != userID {
+		return nil, newError(ErrForbidden, "unauthorized to access this task")
+	}
+
+	return s.tasks.GetTaskStatusHistory(taskID)
+}
+
+// FilterError is returned when a task list filter is invalid
+type FilterError struct {
+	Message string
+}
+
+func (e *FilterError) Error() string {
+	return e.Message
+}
+
+func (e *FilterError) Unwrap() error {
+	return ErrValidation
+}
+
+// validateTaskFilter checks the sort value, date range and paging of a list filter
+func validateTaskFilter(filter models.TaskFilter) error {
+	if err := repositories.ValidateTaskSort(filter.Sort); err != nil {
+		return &FilterError{err.Error()}
+	}
+	if filter.CreatedAfter != nil && filter.CreatedBefore != nil && !filter.CreatedAfter.Before(*filter.CreatedBefore) {
+		return &FilterError{"created_after must be before created_before"}
+	}
+	if filter.Limit < 0 {
+		return &FilterError{"limit must be greater than zero"}
+	}
+	if filter.Offset < 0 {
+		return &FilterError{"offset must not be negative"}
+	}
+	if filter.Cursor != nil {
+		if filter.Offset > 0 {
+			return &FilterError{"cursor cannot be combined with offset"}
+		}
+		if filter.Sort != "" && filter.Sort != repositories.DefaultTaskSort {
+			return &FilterError{"cursor can only be used with the default sort"}
+		}
+	}
+	return nil
+}
+
+// pageSize returns the limit to apply: DEFAULT_PAGE_SIZE when none was
+// requested, and at most MAX_PAGE_SIZE
+func (s *TaskService) pageSize(limit int) int {
+	if limit == 0 {
+		limit = s.cfg.DefaultPageSize
+	}
+	if limit > s.cfg.MaxPageSize {
+		limit = s.cfg.MaxPageSize
+	}
+	return limit
+}
+
+// GetUserTasks retrieves a page of a user's tasks matching the filter. A
+// user_id filter may only name the user themselves.
+func (s *TaskService) GetUserTasks(userID string, filter models.TaskFilter) (*models.TaskPage, error) {
+	if filter.UserID != "" && filter.UserID != userID {
+		return nil, newError(ErrForbidden, "only admins can list another user's tasks")
+	}
+	filter.UserID = ""
+
+	page, err := s.listTasks(filter, func(filter models.TaskFilter) ([]*models.Task, error) {
+		return s.tasks.GetUserTasks(userID, filter)
+	}, func(filter models.TaskFilter) (int, error) {
+		return s.tasks.CountUserTasks(userID, filter)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, task := range page.Tasks {
+		hideOwnerEmail(task)
+	}
+	return page, nil
+}
+
+// GetAllTasks retrieves a page of all tasks matching the filter, with their
+// owners (for admins and viewers; only admins get the owners' emails). A
+// user_id filter narrows it to one user's tasks.
+func (s *TaskService) GetAllTasks(filter models.TaskFilter, isAdmin bool) (*models.TaskPage, error) {
+	page, err := s.listTasks(filter, s.tasks.GetAllTasks, s.tasks.CountAllTasks)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdmin {
+		for _, task := range page.Tasks {
+			hideOwnerEmail(task)
+		}
+	}
+	return page, nil
+}
+
+// listTasks validates the filter and fetches one page with list, plus the
+// total from count when the filter asks for it. One extra task is fetched
+// to tell whether more follow the page.
+func (s *TaskService) listTasks(filter models.TaskFilter, list func(models.TaskFilter) ([]*models.Task, error), count func(models.TaskFilter) (int, error)) (*models.TaskPage, error) {
+	if err := validateTaskFilter(filter); err != nil {
+		return nil, err
+	}
+	limit := s.pageSize(filter.Limit)
+
+	filter.Limit = limit + 1
+	tasks, err := list(filter)
 	if err != nil {
 		return nil, err
 	}
+
+	page := &models.TaskPage{Limit: limit, Offset: filter.Offset}
+	if len(tasks) > limit {
+		tasks = tasks[:limit]
+		page.HasMore = true
+	}
 	for _, task := range tasks {
 		task.UserID = ""
 	}
-	return tasks, nil
+	page.Tasks = tasks
+
+	if filter.CountTotal {
+		if page.Total, err = count(filter); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// CountTasksByStatus returns task counts per status, including zero counts
+func (s *TaskService) CountTasksByStatus(ctx context.Context, userID string, isAdmin bool) (map[string]int, error) {
+	counts, err := s.tasks.CountTasksByStatus(ctx, userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, status := range models.Statuses {
+		if _, exists := counts[status]; !exists {
+			counts[status] = 0
+		}
+	}
+	return counts, nil
+}
+
+// GetTaskBoard returns a user's unarchived tasks grouped by status, with at
+// most perColumn tasks per status (DEFAULT_PAGE_SIZE when zero, capped at
+// MAX_PAGE_SIZE). Admins see their own board unless they name another user
+// with ownerID; other users may only name themselves.
+func (s *TaskService) GetTaskBoard(ctx context.Context, userID string, ownerID string, isAdmin bool, perColumn int) (models.TaskBoard, error) {
+	if ownerID != "" && ownerID != userID {
+		if !isAdmin {
+			return nil, newError(ErrForbidden, "only admins can view another user's board")
+		}
+		userID = ownerID
+	}
+	if perColumn < 0 {
+		return nil, newError(ErrValidation, "per_column must be greater than zero")
+	}
+
+	tasks, err := s.tasks.GetTaskBoard(ctx, userID, s.pageSize(perColumn))
+	if err != nil {
+		return nil, err
+	}
+
+	board := make(models.TaskBoard, len(models.Statuses))
+	for _, status := range models.Statuses {
+		board[status] = []*models.Task{}
+	}
+	for _, task := range tasks {
+		task.UserID = ""
+		board[task.Status] = append(board[task.Status], task)
+	}
+	return board, nil
 }
 
-// GetAllTasks retrieves all tasks (for admin)
-func (s *TaskService) GetAllTasks() ([]*models.Task, error) {
-	tasks, err := repositories.GetAllTasks(s.db)
+// Default and largest look-ahead window for GetUpcomingTasks
+const (
+	defaultUpcomingWindow = 24 * time.Hour
+	maxUpcomingWindow     = 30 * 24 * time.Hour
+)
+
+// GetUpcomingTasks returns the caller's open tasks that are overdue or due
+// within the given window, soonest first, for reminders. A zero window means
+// 24 hours and a zero limit the default page size.
+func (s *TaskService) GetUpcomingTasks(ctx context.Context, userID string, within time.Duration, limit int) ([]*models.Task, error) {
+	if within == 0 {
+		within = defaultUpcomingWindow
+	}
+	if within < 0 || within > maxUpcomingWindow {
+		return nil, newError(ErrValidation, "within must be a positive duration of at most %dh", int(maxUpcomingWindow.Hours()))
+	}
+	if limit < 0 {
+		return nil, newError(ErrValidation, "limit must be greater than zero")
+	}
+
+	tasks, err := s.tasks.GetUpcomingTasks(ctx, userID, time.Now().Add(within), s.pageSize(limit))
 	if err != nil {
 		return nil, err
 	}
@@ -152,53 +1101,487 @@ func (s *TaskService) GetAllTasks() ([]*models.Task, error) {
 	return tasks, nil
 }
 
-// UpdateTask updates a task
-func (s *TaskService) UpdateTask(userID string, taskID string, req *models.UpdateTaskRequest, isAdmin bool) (*models.Task, error) {
-	task, err := repositories.GetTaskByID(s.db, taskID)
+// CountTasksByDay returns the tasks created and completed on each UTC day
+// from from to to inclusive (for admin). to defaults to today and from to
+// 29 days before to. The range may span at most STATS_MAX_DAYS days.
+func (s *TaskService) CountTasksByDay(ctx context.Context, from *time.Time, to *time.Time) ([]models.DailyTaskCount, error) {
+	end := time.Now().UTC().Truncate(24 * time.Hour)
+	if to != nil {
+		end = to.UTC().Truncate(24 * time.Hour)
+	}
+	start := end.AddDate(0, 0, -29)
+	if from != nil {
+		start = from.UTC().Truncate(24 * time.Hour)
+	}
+
+	if start.After(end) {
+		return nil, newError(ErrValidation, "from must not be after to")
+	}
+	if days := int(end.Sub(start).Hours()/24) + 1; days > s.cfg.StatsMaxDays {
+		return nil, newError(ErrValidation, "date range must span at most %d days", s.cfg.StatsMaxDays)
+	}
+
+	return s.tasks.CountTasksByDay(ctx, start, end)
+}
+
+// PreviewAutoCompletion returns the tasks the worker would auto-complete if
+// tasks older than minutes were due. Zero minutes means the configured
+// AutoCompleteMinutes.
+func (s *TaskService) PreviewAutoCompletion(ctx context.Context, minutes int) (*models.AutoCompletePreview, error) {
+	if minutes == 0 {
+		minutes = s.cfg.AutoCompleteMinutes
+	}
+	if minutes < 1 {
+		return nil, newError(ErrValidation, "minutes must be a positive integer")
+	}
+
+	tasks, err := s.tasks.GetTasksForAutoCompletion(ctx, minutes)
 	if err != nil {
 		return nil, err
 	}
 
-	// Check authorization (user can only update their own tasks, unless admin)
-	if !isAdmin && task.UserID != userID {
-		return nil, errors.New("unauthorized to update this task")
+	return &models.AutoCompletePreview{Minutes: minutes, Count: len(tasks), Tasks: tasks}, nil
+}
+
+// PurgeCompletedTasks permanently deletes tasks completed more than days
+// ago (for admin). Zero days means the configured PurgeCompletedAfterDays.
+func (s *TaskService) PurgeCompletedTasks(ctx context.Context, days int) (*models.PurgeResult, error) {
+	if days == 0 {
+		days = s.cfg.PurgeCompletedAfterDays
+	}
+	if days < 1 {
+		return nil, newError(ErrValidation, "older_than_days must be a positive integer")
+	}
+
+	purged, err := s.tasks.PurgeCompletedTasks(ctx, days)
+	if err != nil {
+		return nil, err
 	}
 
-	// Validate status
-	validStatuses := map[string]bool{"pending": true, "in_progress": true, "completed": true}
-	if req.Status != "" && !validStatuses[req.Status] {
-		return nil, errors.New("invalid status")
+	slog.InfoContext(ctx, "Purged completed tasks", "older_than_days", days, "purged", purged)
+	return &models.PurgeResult{OlderThanDays: days, Purged: purged}, nil
+}
+
+// TransferTasks moves all of one user's tasks to another user in a single
+// transaction (for admin), such as when the first user leaves
+func (s *TaskService) TransferTasks(ctx context.Context, fromUserID string, req *models.TransferTasksRequest) (*models.TransferTasksResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+	if req.TargetUserID == fromUserID {
+		return nil, newError(ErrValidation, "cannot transfer tasks to the same user")
 	}
 
-	if req.Title != "" {
-		task.Title = req.Title
+	if _, err := s.users.GetUserByID(fromUserID); err != nil {
+		return nil, err
 	}
-	if req.Description != "" {
-		task.Description = req.Description
+	if _, err := s.users.GetUserByID(req.TargetUserID); err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			return nil, newError(ErrValidation, "target user not found")
+		}
+		return nil, err
 	}
-	if req.Status != "" {
-		task.Status = req.Status
+
+	var transferred int64
+	err := s.tasks.WithTx(ctx, func(tasks repositories.TaskRepository) error {
+		var err error
+		transferred, err = tasks.TransferTasks(ctx, fromUserID, req.TargetUserID)
+		return err
+	})
+	if err != nil {
+		return nil, taskConflictError(err)
 	}
 
-	if err := repositories.UpdateTask(s.db, task); err != nil {
+	slog.InfoContext(ctx, "Transferred tasks", "from_user_id", fromUserID, "to_user_id", req.TargetUserID, "transferred", transferred)
+	return &models.TransferTasksResponse{Transferred: transferred}, nil
+}
+
+// UpdateTask updates a task. The read, authorization check and write run in
+// one transaction with the task row locked. An update that would leave the
+// task as it is writes nothing, so its version and updated_at stay put.
+func (s *TaskService) UpdateTask(ctx context.Context, userID string, taskID string, req *models.UpdateTaskRequest, isAdmin bool) (*models.Task, error) {
+	if err := s.validateTaskRequest(req, req.Description); err != nil {
 		return nil, err
 	}
 
+	// An empty title or description leaves the current value unchanged
+	title := strings.TrimSpace(req.Title)
+	description := strings.TrimSpace(req.Description)
+
+	var tags []string
+	if req.Tags != nil {
+		tags = normalizeTags(*req.Tags)
+	}
+
+	// Only admins may reassign a task, and only to an existing user
+	if req.AssigneeUserID != "" {
+		if !isAdmin {
+			return nil, newError(ErrForbidden, "only admins can reassign tasks")
+		}
+		if _, err := s.users.GetUserByID(req.AssigneeUserID); err != nil {
+			if errors.Is(err, repositories.ErrUserNotFound) {
+				return nil, newError(ErrValidation, "assignee user not found")
+			}
+			return nil, err
+		}
+	}
+
+	var task *models.Task
+	var previousStatus, ownerID string
+
+	// Retried on deadlocks and serialization failures; every attempt rereads
+	// the task, so state from a failed attempt is overwritten
+	err := s.tasks.WithRetryTx(ctx, func(tasks repositories.TaskRepository) error {
+		var err error
+		task, err = tasks.GetTaskByIDForUpdate(taskID)
+		if err != nil {
+			return err
+		}
+
+		// Check authorization (user can only update their own tasks, unless admin)
+		if !isAdmin && task.UserID != userID {
+			return newError(ErrForbidden, "unauthorized to update this task")
+		}
+
+		previousStatus = task.Status
+		ownerID = task.UserID
+		current := *task
+
+		contentChanged := (title != "" && title != task.Title) || (description != "" && description != task.Description)
+		if title != "" {
+			task.Title = title
+		}
+		if description != "" {
+			task.Description = description
+		}
+		// A description stored before the current limit would trip the
+		// database's CHECK constraint, so ask for it to be shortened
+		if err := s.validateTaskRequest(&models.UpdateTaskRequest{}, task.Description); err != nil {
+			return err
+		}
+		if req.Status == "" && contentChanged && task.Status == models.StatusPending && s.cfg.AutoStartOnEdit {
+			// The first edit of a pending task's content means work has begun
+			task.Status = models.StatusInProgress
+		}
+		if req.Status != "" {
+			actor := models.ActorUser
+			if isAdmin {
+				actor = models.ActorAdmin
+			}
+			if !models.CanTransition(actor, task.Status, req.Status) {
+				return newError(ErrValidation, "cannot change status from %s to %s", task.Status, req.Status)
+			}
+			task.Status = req.Status
+		}
+		if tags != nil {
+			task.Tags = tags
+		}
+		if req.AutoComplete != nil {
+			task.AutoComplete = *req.AutoComplete
+		}
+		if req.DueDate != nil || req.Recurrence != "" {
+			if req.DueDate != nil {
+				task.DueDate = utcTime(req.DueDate)
+			}
+			rule := task.Recurrence
+			if req.Recurrence != "" {
+				rule = req.Recurrence
+			}
+			// A new rule or due date restarts the schedule, unless this
+			// occurrence already produced its successor
+			alreadyRecurred := task.Recurrence != models.RecurrenceNone && task.NextRunAt == nil
+			scheduleRecurrence(task, rule)
+			if alreadyRecurred {
+				task.NextRunAt = nil
+			}
+		}
+
+		// Clients that send a version only update the state they last saw
+		if req.Version != 0 {
+			task.Version = req.Version
+		}
+
+		reassigned := req.AssigneeUserID != "" && req.AssigneeUserID != task.UserID
+		if !reassigned && sameTaskFields(&current, task) {
+			if task.Version != current.Version {
+				return repositories.ErrVersionConflict
+			}
+			return nil
+		}
+
+		if err := tasks.UpdateTask(task); err != nil {
+			return err
+		}
+
+		if task.Status != previousStatus {
+			if err := tasks.RecordStatusChange(taskID, previousStatus, task.Status, userID); err != nil {
+				return err
+			}
+		}
+
+		if reassigned {
+			if err := tasks.ReassignTask(taskID, req.AssigneeUserID); err != nil {
+				return err
+			}
+			ownerID = req.AssigneeUserID
+		}
+		return nil
+	})
+	if errors.Is(err, repositories.ErrVersionConflict) {
+		return nil, wrapError(ErrConflict, err)
+	}
+	if err != nil {
+		return nil, taskConflictError(err)
+	}
+
 	task.UserID = ""
+	s.statusChanged(task, ownerID, previousStatus)
 	return task, nil
 }
 
-// DeleteTask deletes a task
-func (s *TaskService) DeleteTask(userID string, taskID string, isAdmin bool) error {
-	task, err := repositories.GetTaskByID(s.db, taskID)
+// sameTaskFields reports whether two versions of a task agree on every field
+// an update can change
+func sameTaskFields(a *models.Task, b *models.Task) bool {
+	return a.Title == b.Title &&
+		a.Description == b.Description &&
+		a.Status == b.Status &&
+		slices.Equal(a.Tags, b.Tags) &&
+		sameTime(a.DueDate, b.DueDate) &&
+		a.Recurrence == b.Recurrence &&
+		sameTime(a.NextRunAt, b.NextRunAt) &&
+		a.AutoComplete == b.AutoComplete
+}
+
+// sameTime reports whether two optional times are both unset or equal
+func sameTime(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// ForceTaskStatus sets a task's status on behalf of an admin, bypassing the
+// transition table, and records the change under the admin's ID. Setting
+// the status a task already has changes nothing.
+func (s *TaskService) ForceTaskStatus(ctx context.Context, adminID string, taskID string, status string) (*models.Task, error) {
+	var task *models.Task
+	var previousStatus, ownerID string
+
+	err := s.tasks.WithTx(ctx, func(tasks repositories.TaskRepository) error {
+		var err error
+		task, err = tasks.GetTaskByIDForUpdate(taskID)
+		if err != nil {
+			return err
+		}
+
+		previousStatus = task.Status
+		ownerID = task.UserID
+		if task.Status == status {
+			return nil
+		}
+
+		task.Status = status
+		if err := tasks.UpdateTask(task); err != nil {
+			return err
+		}
+		return tasks.RecordStatusChange(taskID, previousStatus, status, adminID)
+	})
 	if err != nil {
+		return nil, taskConflictError(err)
+	}
+
+	task.UserID = ""
+	s.statusChanged(task, ownerID, previousStatus)
+	return task, nil
+}
+
+// statusChanged notifies stream subscribers, metrics and webhooks after a
+// user or admin changed a task's status
+func (s *TaskService) statusChanged(task *models.Task, ownerID string, previousStatus string) {
+	if previousStatus == task.Status {
+		return
+	}
+
+	s.hub.Publish(ownerID, events.TaskEvent{
+		Type:           events.TypeTaskStatusChanged,
+		TaskID:         task.ID,
+		Status:         task.Status,
+		PreviousStatus: previousStatus,
+		Source:         "user",
+		Timestamp:      task.UpdatedAt,
+	})
+	if task.Status == models.StatusCompleted {
+		metrics.TasksCompletedTotal.WithLabelValues("user").Inc()
+		s.notifier.TaskCompleted(task, ownerID, "user")
+	}
+}
+
+// DeleteTask soft-deletes a task, checking ownership with the row locked
+func (s *TaskService) DeleteTask(ctx context.Context, userID string, taskID string, isAdmin bool) error {
+	return s.tasks.WithTx(ctx, func(tasks repositories.TaskRepository) error {
+		task, err := tasks.GetTaskByIDForUpdate(taskID)
+		if err != nil {
+			return err
+		}
+
+		// Check authorization
+		if !isAdmin && task.UserID != userID {
+			return newError(ErrForbidden, "unauthorized to delete this task")
+		}
+
+		return tasks.DeleteTask(taskID)
+	})
+}
+
+// HardDeleteTask permanently deletes a task (for admin)
+func (s *TaskService) HardDeleteTask(taskID string, isAdmin bool) error {
+	if !isAdmin {
+		return newError(ErrForbidden, "unauthorized to delete this task")
+	}
+
+	return s.tasks.HardDeleteTask(taskID)
+}
+
+// RestoreTask restores a soft-deleted task
+func (s *TaskService) RestoreTask(userID string, taskID string, isAdmin bool) (*models.Task, error) {
+	task, err := s.tasks.RestoreTask(taskID, userID, isAdmin)
+	if err != nil {
+		return nil, taskConflictError(err)
+	}
+	task.UserID = ""
+	return task, nil
+}
+
+// ArchiveTask hides a task from the default task list without deleting it.
+// Only the task's owner or an admin may archive it.
+func (s *TaskService) ArchiveTask(ctx context.Context, userID string, taskID string, isAdmin bool) (*models.Task, error) {
+	return s.setArchived(ctx, userID, taskID, isAdmin, true)
+}
+
+// UnarchiveTask returns an archived task to the default task list. Only the
+// task's owner or an admin may unarchive it.
+func (s *TaskService) UnarchiveTask(ctx context.Context, userID string, taskID string, isAdmin bool) (*models.Task, error) {
+	return s.setArchived(ctx, userID, taskID, isAdmin, false)
+}
+
+// setArchived archives or unarchives a task with its row locked for the
+// ownership check
+func (s *TaskService) setArchived(ctx context.Context, userID string, taskID string, isAdmin bool, archived bool) (*models.Task, error) {
+	var task *models.Task
+	err := s.tasks.WithTx(ctx, func(tasks repositories.TaskRepository) error {
+		current, err := tasks.GetTaskByIDForUpdate(taskID)
+		if err != nil {
+			return err
+		}
+		if !isAdmin && current.UserID != userID {
+			return newError(ErrForbidden, "unauthorized to access this task")
+		}
+
+		task, err = tasks.SetTaskArchived(taskID, archived)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Check authorization
-	if !isAdmin && task.UserID != userID {
-		return errors.New("unauthorized to delete this task")
+	task.UserID = ""
+	return task, nil
+}
+
+// UpdateTasksStatus moves several tasks to one status in a single
+// transaction. Tasks that don't exist, that the caller doesn't own (unless
+// admin) or that can't make the transition are skipped and reported. Tasks
+// already in the status are left alone.
+func (s *TaskService) UpdateTasksStatus(ctx context.Context, userID string, req *models.BulkStatusRequest, isAdmin bool) (*models.BulkStatusResponse, error) {
+	if !models.ValidStatus(req.Status) {
+		return nil, newError(ErrValidation, "invalid status")
+	}
+	if len(req.IDs) == 0 {
+		return nil, newError(ErrValidation, "at least one task id is required")
+	}
+	if len(req.IDs) > maxBulkTasks {
+		return nil, newError(ErrValidation, "cannot update more than %d tasks at once", maxBulkTasks)
+	}
+
+	actor := models.ActorUser
+	if isAdmin {
+		actor = models.ActorAdmin
+	}
+
+	// Lock rows in a stable order so concurrent bulk updates can't deadlock
+	ids := make([]string, 0, len(req.IDs))
+	seen := make(map[string]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	type change struct {
+		task           *models.Task
+		previousStatus string
+	}
+	var changes []change
+	skipped := []string{}
+
+	err := s.tasks.WithTx(ctx, func(tasks repositories.TaskRepository) error {
+		for _, id := range ids {
+			task, err := tasks.GetTaskByIDForUpdate(id)
+			if errors.Is(err, repositories.ErrNotFound) {
+				skipped = append(skipped, id)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			if (!isAdmin && task.UserID != userID) || !models.CanTransition(actor, task.Status, req.Status) {
+				skipped = append(skipped, id)
+				continue
+			}
+			if task.Status == req.Status {
+				continue
+			}
+
+			previousStatus := task.Status
+			task.Status = req.Status
+			if err := tasks.UpdateTask(task); err != nil {
+				return err
+			}
+			if err := tasks.RecordStatusChange(id, previousStatus, req.Status, userID); err != nil {
+				return err
+			}
+			changes = append(changes, change{task: task, previousStatus: previousStatus})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, taskConflictError(err)
+	}
+
+	for _, c := range changes {
+		ownerID := c.task.UserID
+		c.task.UserID = ""
+		s.statusChanged(c.task, ownerID, c.previousStatus)
+	}
+	return &models.BulkStatusResponse{Requested: len(req.IDs), Updated: len(changes), Skipped: skipped}, nil
+}
+
+// DeleteTasks deletes several tasks and returns how many were removed
+func (s *TaskService) DeleteTasks(ctx context.Context, userID string, ids []string, isAdmin bool) (*models.BulkDeleteResponse, error) {
+	if len(ids) == 0 {
+		return nil, newError(ErrValidation, "at least one task id is required")
+	}
+	if len(ids) > maxBulkTasks {
+		return nil, newError(ErrValidation, "cannot delete more than %d tasks at once", maxBulkTasks)
+	}
+
+	deleted, err := s.tasks.DeleteTasks(ctx, ids, userID, isAdmin)
+	if err != nil {
+		return nil, err
 	}
 
-	return repositories.DeleteTask(s.db, taskID)
+	return &models.BulkDeleteResponse{Requested: len(ids), Deleted: deleted}, nil
 }
@@ -0,0 +1,422 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"taskapi/models"
+	"taskapi/repositories"
+	"testing"
+	"time"
+)
+
+const (
+	ownerID  = "11111111-1111-1111-1111-111111111111"
+	otherID  = "22222222-2222-2222-2222-222222222222"
+	adminID  = "33333333-3333-3333-3333-333333333333"
+	viewerID = "66666666-6666-6666-6666-666666666666"
+	taskID   = "44444444-4444-4444-4444-444444444444"
+)
+
+// newTestTask returns a pending task owned by ownerID
+func newTestTask() *models.Task {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return &models.Task{
+		ID:           taskID,
+		UserID:       ownerID,
+		Title:        "Write report",
+		Description:  "Quarterly numbers",
+		Status:       models.StatusPending,
+		Version:      1,
+		Tags:         []string{"work"},
+		Recurrence:   models.RecurrenceNone,
+		AutoComplete: true,
+		CreatedAt:    created,
+		UpdatedAt:    created,
+	}
+}
+
+func newTestTaskService(tasks *fakeTaskRepo) *TaskService {
+	users := newFakeUserRepo(
+		&models.User{ID: ownerID, Role: models.RoleUser},
+		&models.User{ID: otherID, Role: models.RoleUser},
+		&models.User{ID: adminID, Role: models.RoleAdmin},
+		&models.User{ID: viewerID, Role: models.RoleViewer},
+	)
+	return NewTaskService(tasks, users, testConfig(), nil, nil)
+}
+
+func TestUpdateTask(t *testing.T) {
+	tests := []struct {
+		name      string
+		userID    string
+		isAdmin   bool
+		req       models.UpdateTaskRequest
+		wantErr   error
+		wantOwner string
+		check     func(t *testing.T, task *models.Task)
+	}{
+		{
+			name:   "owner changes the title",
+			userID: ownerID,
+			req:    models.UpdateTaskRequest{Title: "Write the report"},
+			check: func(t *testing.T, task *models.Task) {
+				if task.Title != "Write the report" {
+					t.Errorf("title = %q, want %q", task.Title, "Write the report")
+				}
+				if task.Version != 2 {
+					t.Errorf("version = %d, want 2", task.Version)
+				}
+			},
+		},
+		{
+			name:   "omitted fields keep their values",
+			userID: ownerID,
+			req:    models.UpdateTaskRequest{Description: "Annual numbers"},
+			check: func(t *testing.T, task *models.Task) {
+				if task.Title != "Write report" {
+					t.Errorf("title = %q, want it unchanged", task.Title)
+				}
+				if task.Description != "Annual numbers" {
+					t.Errorf("description = %q, want %q", task.Description, "Annual numbers")
+				}
+				if task.Status != models.StatusPending {
+					t.Errorf("status = %q, want it unchanged", task.Status)
+				}
+				if len(task.Tags) != 1 || task.Tags[0] != "work" {
+					t.Errorf("tags = %v, want them unchanged", task.Tags)
+				}
+			},
+		},
+		{
+			name:   "owner starts the task",
+			userID: ownerID,
+			req:    models.UpdateTaskRequest{Status: models.StatusInProgress},
+			check: func(t *testing.T, task *models.Task) {
+				if task.Status != models.StatusInProgress {
+					t.Errorf("status = %q, want %q", task.Status, models.StatusInProgress)
+				}
+			},
+		},
+		{
+			name:    "another user is forbidden",
+			userID:  otherID,
+			req:     models.UpdateTaskRequest{Title: "Mine now"},
+			wantErr: ErrForbidden,
+		},
+		{
+			name:    "admin may update any task",
+			userID:  adminID,
+			isAdmin: true,
+			req:     models.UpdateTaskRequest{Title: "Checked by admin"},
+			check: func(t *testing.T, task *models.Task) {
+				if task.Title != "Checked by admin" {
+					t.Errorf("title = %q, want %q", task.Title, "Checked by admin")
+				}
+			},
+		},
+		{
+			name:    "unknown status",
+			userID:  ownerID,
+			req:     models.UpdateTaskRequest{Status: "done"},
+			wantErr: ErrValidation,
+		},
+		{
+			name:    "transition outside the workflow",
+			userID:  ownerID,
+			req:     models.UpdateTaskRequest{Status: models.StatusCompleted},
+			wantErr: ErrValidation,
+		},
+		{
+			name:    "title too long",
+			userID:  ownerID,
+			req:     models.UpdateTaskRequest{Title: strings.Repeat("a", 256)},
+			wantErr: ErrValidation,
+		},
+		{
+			name:    "stale version",
+			userID:  ownerID,
+			req:     models.UpdateTaskRequest{Title: "Late edit", Version: 7},
+			wantErr: ErrConflict,
+		},
+		{
+			name:    "non-admin reassignment",
+			userID:  ownerID,
+			req:     models.UpdateTaskRequest{AssigneeUserID: otherID},
+			wantErr: ErrForbidden,
+		},
+		{
+			name:    "reassignment to an unknown user",
+			userID:  adminID,
+			isAdmin: true,
+			req:     models.UpdateTaskRequest{AssigneeUserID: "55555555-5555-5555-5555-555555555555"},
+			wantErr: ErrValidation,
+		},
+		{
+			name:      "admin reassigns the task",
+			userID:    adminID,
+			isAdmin:   true,
+			req:       models.UpdateTaskRequest{AssigneeUserID: otherID},
+			wantOwner: otherID,
+			check:     func(t *testing.T, task *models.Task) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeTaskRepo(newTestTask())
+			svc := newTestTaskService(repo)
+
+			task, err := svc.UpdateTask(context.Background(), tt.userID, taskID, &tt.req, tt.isAdmin)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				if repo.writes != 0 {
+					t.Errorf("rejected update wrote %d times", repo.writes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UpdateTask: %v", err)
+			}
+			if task.UserID != "" {
+				t.Errorf("returned task exposes its owner %q", task.UserID)
+			}
+			wantOwner := tt.wantOwner
+			if wantOwner == "" {
+				wantOwner = ownerID
+			}
+			if owner := repo.tasks[taskID].UserID; owner != wantOwner {
+				t.Errorf("stored owner = %q, want %q", owner, wantOwner)
+			}
+			tt.check(t, task)
+		})
+	}
+}
+
+func TestUpdateTaskNoOp(t *testing.T) {
+	autoComplete := true
+	tags := []string{"work"}
+	tests := []struct {
+		name    string
+		req     models.UpdateTaskRequest
+		wantErr error
+	}{
+		{name: "empty request", req: models.UpdateTaskRequest{}},
+		{
+			name: "identical values",
+			req: models.UpdateTaskRequest{
+				Title:        "Write report",
+				Description:  "Quarterly numbers",
+				Status:       models.StatusPending,
+				Tags:         &tags,
+				AutoComplete: &autoComplete,
+				Version:      1,
+			},
+		},
+		{
+			name:    "identical values at a stale version",
+			req:     models.UpdateTaskRequest{Title: "Write report", Version: 7},
+			wantErr: ErrConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := newTestTask()
+			repo := newFakeTaskRepo(stored)
+			svc := newTestTaskService(repo)
+
+			task, err := svc.UpdateTask(context.Background(), ownerID, taskID, &tt.req, false)
+			if repo.writes != 0 {
+				t.Errorf("no-op update wrote %d times", repo.writes)
+			}
+			if len(repo.history) != 0 {
+				t.Errorf("no-op update recorded status history %+v", repo.history)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UpdateTask: %v", err)
+			}
+			if !task.UpdatedAt.Equal(stored.UpdatedAt) {
+				t.Errorf("updated_at = %v, want it unchanged at %v", task.UpdatedAt, stored.UpdatedAt)
+			}
+			if task.Version != stored.Version {
+				t.Errorf("version = %d, want it unchanged at %d", task.Version, stored.Version)
+			}
+		})
+	}
+}
+
+func TestRegisterUsesConfiguredBcryptCost(t *testing.T) {
+	for _, cost := range []int{bcrypt.MinCost, bcrypt.MinCost + 1} {
+		users := newFakeUserRepo()
+		cfg := testConfig()
+		cfg.BcryptCost = cost
+		svc := NewUserService(users, cfg)
+
+		resp, err := svc.Register(context.Background(), &models.RegisterRequest{
+			Email:    "alice@example.com",
+			Username: "alice",
+			Password: "correct horse",
+		})
+		if err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+		if resp.User.Password != "" {
+			t.Error("response exposes the password hash")
+		}
+
+		stored, err := users.GetUserByID(resp.User.ID)
+		if err != nil {
+			t.Fatalf("GetUserByID: %v", err)
+		}
+		got, err := bcrypt.Cost([]byte(stored.Password))
+		if err != nil {
+			t.Fatalf("bcrypt.Cost: %v", err)
+		}
+		if got != cost {
+			t.Errorf("stored hash cost = %d, want %d", got, cost)
+		}
+	}
+}
+
+func TestGetTask(t *testing.T) {
+	tests := []struct {
+		name         string
+		userID       string
+		isAdmin      bool
+		isViewer     bool
+		includeOwner bool
+		wantErr      error
+		wantOwner    bool
+		wantEmail    string
+	}{
+		{name: "owner reads their task", userID: ownerID},
+		{name: "owner reads their task with its owner", userID: ownerID, includeOwner: true, wantOwner: true},
+		{name: "another user is forbidden", userID: otherID, wantErr: ErrForbidden},
+		{name: "another user is forbidden with include=owner", userID: otherID, includeOwner: true, wantErr: ErrForbidden},
+		{name: "admin reads any task with the owner's email", userID: adminID, isAdmin: true, wantOwner: true, wantEmail: "owner@example.com"},
+		{name: "viewer reads any task without the owner's email", userID: viewerID, isViewer: true, wantOwner: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestTaskService(newFakeTaskRepo(newTestTask()))
+
+			task, err := svc.GetTask(tt.userID, taskID, tt.isAdmin, tt.isViewer, tt.includeOwner)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				if task != nil {
+					t.Errorf("forbidden read returned task %+v", task)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetTask: %v", err)
+			}
+			if task.UserID != "" {
+				t.Errorf("returned task exposes its owner %q", task.UserID)
+			}
+			if (task.Owner != nil) != tt.wantOwner {
+				t.Fatalf("owner = %+v, want it included = %v", task.Owner, tt.wantOwner)
+			}
+			if task.Owner != nil && task.Owner.Email != tt.wantEmail {
+				t.Errorf("owner email = %q, want %q", task.Owner.Email, tt.wantEmail)
+			}
+		})
+	}
+}
+
+func TestGetAllTasksOwnerEmails(t *testing.T) {
+	tests := []struct {
+		name      string
+		isAdmin   bool
+		wantEmail string
+	}{
+		{name: "admin sees owners' emails", isAdmin: true, wantEmail: "owner@example.com"},
+		{name: "viewer does not", isAdmin: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestTaskService(newFakeTaskRepo(newTestTask()))
+			svc.cfg.DefaultPageSize = 2
+			svc.cfg.MaxPageSize = 4
+
+			page, err := svc.GetAllTasks(models.TaskFilter{}, tt.isAdmin)
+			if err != nil {
+				t.Fatalf("GetAllTasks: %v", err)
+			}
+			if len(page.Tasks) != 1 || page.Tasks[0].Owner == nil {
+				t.Fatalf("tasks = %+v, want the one task with its owner", page.Tasks)
+			}
+			if email := page.Tasks[0].Owner.Email; email != tt.wantEmail {
+				t.Errorf("owner email = %q, want %q", email, tt.wantEmail)
+			}
+		})
+	}
+}
+
+func TestGetTaskMissing(t *testing.T) {
+	svc := newTestTaskService(newFakeTaskRepo())
+
+	if _, err := svc.GetTask(ownerID, taskID, false, false, false); !errors.Is(err, repositories.ErrTaskNotFound) {
+		t.Fatalf("err = %v, want %v", err, repositories.ErrTaskNotFound)
+	}
+}
+
+func TestGetUserTasksPageSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     int
+		wantLimit int
+		wantErr   error
+	}{
+		{name: "no limit uses the default", limit: 0, wantLimit: 2},
+		{name: "limit below the max is kept", limit: 3, wantLimit: 3},
+		{name: "limit above the max is clamped", limit: 50, wantLimit: 4},
+		{name: "negative limit", limit: -1, wantErr: ErrValidation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeTaskRepo()
+			for i := 0; i < 6; i++ {
+				task := newTestTask()
+				task.ID = fmt.Sprintf("44444444-4444-4444-4444-%012d", i)
+				repo.tasks[task.ID] = task
+			}
+			svc := newTestTaskService(repo)
+			svc.cfg.DefaultPageSize = 2
+			svc.cfg.MaxPageSize = 4
+
+			page, err := svc.GetUserTasks(ownerID, models.TaskFilter{Limit: tt.limit})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetUserTasks: %v", err)
+			}
+			if page.Limit != tt.wantLimit {
+				t.Errorf("page limit = %d, want %d", page.Limit, tt.wantLimit)
+			}
+			if len(page.Tasks) != tt.wantLimit {
+				t.Errorf("got %d tasks, want %d", len(page.Tasks), tt.wantLimit)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"taskapi/models"
+	"unicode"
+	"unicode/utf8"
+)
+
+// validate checks request structs against their `validate` tags. Custom
+// tags cover the rules the built-in ones don't:
+//
+//	notblank   not empty after trimming whitespace
+//	nospace    no whitespace anywhere
+//	maxbytes   at most N bytes, for limits such as bcrypt's 72
+//	status     a known task status
+//	recurrence a known recurrence rule
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	// Report fields by the names clients send
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	custom := map[string]validator.Func{
+		"notblank": func(fl validator.FieldLevel) bool {
+			return strings.TrimSpace(fl.Field().String()) != ""
+		},
+		"nospace": func(fl validator.FieldLevel) bool {
+			return strings.IndexFunc(fl.Field().String(), unicode.IsSpace) < 0
+		},
+		"maxbytes": func(fl validator.FieldLevel) bool {
+			limit, err := strconv.Atoi(fl.Param())
+			return err == nil && len(fl.Field().String()) <= limit
+		},
+		"status": func(fl validator.FieldLevel) bool {
+			return models.ValidStatus(fl.Field().String())
+		},
+		"recurrence": func(fl validator.FieldLevel) bool {
+			return models.ValidRecurrence(fl.Field().String())
+		},
+	}
+	for tag, fn := range custom {
+		if err := v.RegisterValidation(tag, fn); err != nil {
+			panic(err)
+		}
+	}
+	return v
+}
+
+// ValidationError is returned when a request fails its struct validation.
+// Fields maps each invalid field, by its JSON name, to a message.
+type ValidationError struct {
+	Fields map[string]string
+}
+
+// Error lists every field message, ordered by field name
+func (e *ValidationError) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	messages := make([]string, len(names))
+	for i, name := range names {
+		messages[i] = e.Fields[name]
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
+
+// validateRequest checks a decoded request against its `validate` tags and
+// returns a *ValidationError naming every invalid field
+func validateRequest(req interface{}) error {
+	err := validate.Struct(req)
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		return err
+	}
+
+	fields := make(map[string]string, len(fieldErrs))
+	for _, fe := range fieldErrs {
+		// Report problems inside a slice (tags[3]) against the slice itself
+		name, _, _ := strings.Cut(fe.Field(), "[")
+		if _, seen := fields[name]; !seen {
+			fields[name] = fieldMessage(name, fe)
+		}
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// validateTaskRequest validates a task create or update request like
+// validateRequest, and also checks its description against
+// MAX_DESCRIPTION_LENGTH, which a static tag can't express. The database's
+// CHECK constraint is set to the same limit on startup, so this check fails
+// first and names the field.
+func (s *TaskService) validateTaskRequest(req interface{}, description string) error {
+	err := validateRequest(req)
+	if utf8.RuneCountInString(description) <= s.cfg.MaxDescriptionLength {
+		return err
+	}
+
+	validationErr := &ValidationError{Fields: map[string]string{}}
+	if err != nil && !errors.As(err, &validationErr) {
+		return err
+	}
+	validationErr.Fields["description"] = fmt.Sprintf("description must be at most %d characters", s.cfg.MaxDescriptionLength)
+	return validationErr
+}
+
+// fieldMessage describes why a field failed one validation tag
+func fieldMessage(name string, fe validator.FieldError) string {
+	inSlice := strings.Contains(fe.Field(), "[")
+	switch fe.Tag() {
+	case "required", "notblank":
+		if inSlice {
+			return fmt.Sprintf("%s must not be empty", name)
+		}
+		return fmt.Sprintf("%s is required", name)
+	case "email":
+		return fmt.Sprintf("%s must be a valid email address", name)
+	case "min":
+		return fmt.Sprintf("%s must be at least %s characters", name, fe.Param())
+	case "max":
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("%s must have at most %s items", name, fe.Param())
+		}
+		if inSlice {
+			return fmt.Sprintf("%s must be at most %s characters each", name, fe.Param())
+		}
+		return fmt.Sprintf("%s must be at most %s characters", name, fe.Param())
+	case "maxbytes":
+		return fmt.Sprintf("%s must be at most %s bytes", name, fe.Param())
+	case "nospace":
+		return fmt.Sprintf("%s must not contain whitespace", name)
+	case "uuid":
+		return fmt.Sprintf("%s must be a UUID", name)
+	case "status", "recurrence":
+		return fmt.Sprintf("invalid %s", name)
+	default:
+		return fmt.Sprintf("%s is invalid", name)
+	}
+}
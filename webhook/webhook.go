@@ -0,0 +1,123 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"taskapi/config"
+	"taskapi/models"
+)
+
+const (
+	// SignatureHeader carries the hex HMAC-SHA256 of the request body
+	SignatureHeader = "X-Webhook-Signature"
+
+	// EventTaskCompleted is sent when a task transitions to completed
+	EventTaskCompleted = "task.completed"
+
+	deliveryTimeout = 5 * time.Second
+	maxAttempts     = 3
+	retryDelay      = 1 * time.Second
+)
+
+// Event is the JSON payload POSTed to the webhook URL
+type Event struct {
+	Event     string       `json:"event"`
+	Source    string       `json:"source"` // "user" or "worker"
+	UserID    string       `json:"user_id"`
+	Task      *models.Task `json:"task"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+// Notifier delivers webhook events to a configured URL
+type Notifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewNotifier creates a new webhook notifier. If WEBHOOK_URL is unset the
+// notifier is a no-op.
+func NewNotifier(cfg *config.Config) *Notifier {
+	return &Notifier{
+		url:    cfg.WebhookURL,
+		secret: cfg.WebhookSecret,
+		client: &http.Client{Timeout: deliveryTimeout},
+	}
+}
+
+// TaskCompleted sends a task.completed event in the background
+func (n *Notifier) TaskCompleted(task *models.Task, userID string, source string) {
+	if n == nil || n.url == "" {
+		return
+	}
+
+	// Copy the task so later changes by the caller don't race with delivery
+	taskCopy := *task
+	event := Event{
+		Event:     EventTaskCompleted,
+		Source:    source,
+		UserID:    userID,
+		Task:      &taskCopy,
+		Timestamp: time.Now().UTC(),
+	}
+
+	go n.deliver(event)
+}
+
+// deliver posts the event, retrying a few times; failures are only logged
+func (n *Notifier) deliver(event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Error encoding webhook", "task_id", event.Task.ID, "error", err)
+		return
+	}
+	signature := Sign(body, n.secret)
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err = n.post(body, signature)
+		if err == nil {
+			return
+		}
+
+		slog.Warn("Webhook delivery failed", "task_id", event.Task.ID, "attempt", attempt, "max_attempts", maxAttempts, "error", err)
+		if attempt < maxAttempts {
+			time.Sleep(retryDelay * time.Duration(attempt))
+		}
+	}
+}
+
+// post sends a single delivery attempt
+func (n *Notifier) post(body []byte, signature string) error {
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, signature)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the signature header value for a body: "sha256=<hex hmac>"
+func Sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,152 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"taskapi/config"
+	"taskapi/internal/testdb"
+	"taskapi/middleware"
+	"taskapi/models"
+	"taskapi/repositories"
+	"taskapi/services"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(testdb.Main(m))
+}
+
+// TestAutoCompleteEndToEnd registers a user, logs in, creates tasks with the
+// token's user ID, and lets the worker's bulk check complete the due one
+func TestAutoCompleteEndToEnd(t *testing.T) {
+	db := testdb.New(t)
+	ctx := context.Background()
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	cfg.BcryptCost = 4
+	cfg.AutoCompleteMinutes = 30
+
+	userRepo := repositories.NewUserRepository(db)
+	taskRepo, err := repositories.NewTaskRepository(db)
+	if err != nil {
+		t.Fatalf("NewTaskRepository: %v", err)
+	}
+	defer taskRepo.Close()
+
+	userService := services.NewUserService(userRepo, cfg)
+	taskService := services.NewTaskService(taskRepo, userRepo, cfg, nil, nil)
+
+	// Register and log in
+	if _, err := userService.Register(ctx, &models.RegisterRequest{
+		Email:    "alice@example.com",
+		Username: "alice",
+		Password: "correct horse",
+	}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	login, err := userService.Login(&models.LoginRequest{Email: "alice@example.com", Password: "correct horse"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	claims, err := middleware.ValidateToken(login.Token, cfg)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+
+	// Create one task that is due for auto-completion and one that isn't
+	due, err := taskService.CreateTask(ctx, claims.UserID, &models.CreateTaskRequest{Title: "Due"}, false)
+	if err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+	fresh, err := taskService.CreateTask(ctx, claims.UserID, &models.CreateTaskRequest{Title: "Fresh"}, false)
+	if err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+	if _, err := db.Conn.Exec(`UPDATE tasks SET created_at = NOW() - INTERVAL '1 hour' WHERE id = $1`, due.ID); err != nil {
+		t.Fatalf("backdating task: %v", err)
+	}
+
+	w := NewTaskWorker(taskRepo, cfg, nil, nil)
+	w.completeDueTasks()
+
+	got, err := taskService.GetTask(claims.UserID, due.ID, false, false, false)
+	if err != nil {
+		t.Fatalf("GetTask: %v", err)
+	}
+	if got.Status != models.StatusCompleted {
+		t.Errorf("due task status = %q, want %q", got.Status, models.StatusCompleted)
+	}
+	if got.Version != due.Version+1 {
+		t.Errorf("due task version = %d, want %d", got.Version, due.Version+1)
+	}
+
+	history, err := taskService.GetTaskHistory(claims.UserID, due.ID, false)
+	if err != nil {
+		t.Fatalf("GetTaskHistory: %v", err)
+	}
+	if len(history) != 1 || history[0].NewStatus != models.StatusCompleted || history[0].ChangedBy != models.ChangedBySystem {
+		t.Errorf("history = %+v, want one completion by %q", history, models.ChangedBySystem)
+	}
+
+	got, err = taskService.GetTask(claims.UserID, fresh.ID, false, false, false)
+	if err != nil {
+		t.Fatalf("GetTask: %v", err)
+	}
+	if got.Status != models.StatusPending {
+		t.Errorf("fresh task status = %q, want %q", got.Status, models.StatusPending)
+	}
+}
+
+// TestSubmitTaskEndToEnd completes a task submitted to the worker's queue
+func TestSubmitTaskEndToEnd(t *testing.T) {
+	db := testdb.New(t)
+	ctx := context.Background()
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	cfg.BcryptCost = 4
+
+	userRepo := repositories.NewUserRepository(db)
+	taskRepo, err := repositories.NewTaskRepository(db)
+	if err != nil {
+		t.Fatalf("NewTaskRepository: %v", err)
+	}
+	defer taskRepo.Close()
+
+	userService := services.NewUserService(userRepo, cfg)
+	taskService := services.NewTaskService(taskRepo, userRepo, cfg, nil, nil)
+
+	registered, err := userService.Register(ctx, &models.RegisterRequest{
+		Email:    "bob@example.com",
+		Username: "bob",
+		Password: "correct horse",
+	})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	task, err := taskService.CreateTask(ctx, registered.User.ID, &models.CreateTaskRequest{Title: "Submitted"}, false)
+	if err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+
+	// Process the queue directly rather than through Start's goroutines
+	w := NewTaskWorker(taskRepo, cfg, nil, nil)
+	if err := w.SubmitTask(ctx, task.ID); err != nil {
+		t.Fatalf("SubmitTask: %v", err)
+	}
+	w.autoCompleteTask(<-w.taskChannel)
+
+	got, err := taskService.GetTask(registered.User.ID, task.ID, false, false, false)
+	if err != nil {
+		t.Fatalf("GetTask: %v", err)
+	}
+	if got.Status != models.StatusCompleted {
+		t.Errorf("status = %q, want %q", got.Status, models.StatusCompleted)
+	}
+}
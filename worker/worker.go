@@ -1,67 +1,148 @@
 package worker
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
 	"taskapi/config"
-	"taskapi/database"
+	"taskapi/events"
+	"taskapi/metrics"
+	"taskapi/models"
 	"taskapi/repositories"
+	"taskapi/webhook"
+)
+
+// defaultInterval is used when WORKER_INTERVAL_SECONDS is not positive
+const defaultInterval = 1 * time.Minute
+
+// Retry settings for auto-completing a task after a database error
+const (
+	maxAttempts    = 3
+	initialBackoff = 500 * time.Millisecond
 )
 
 // TaskWorker handles background task auto-completion
 type TaskWorker struct {
-	db              *database.DB
-	cfg             *config.Config
-	taskChannel     chan string
-	stopChannel     chan struct{}
-	wg              sync.WaitGroup
-	mu              sync.Mutex
-	processedTasks  map[string]bool
+	tasks       repositories.TaskRepository
+	cfg         *config.Config
+	taskChannel chan string
+	stopChannel chan struct{}
+	wg          sync.WaitGroup
+	notifier    *webhook.Notifier
+	hub         *events.Hub
+	// interval is how often the checker and recurrence goroutines run
+	interval time.Duration
+
+	// submitMu guards stopped, so SubmitTask never sends on the closed
+	// taskChannel
+	submitMu sync.RWMutex
+	stopped  bool
+
+	// mu guards the counters reported by Status
+	mu        sync.Mutex
+	processed int64
+	lastRunAt time.Time
+}
+
+// Status is a snapshot of the worker's queue and progress
+type Status struct {
+	QueueDepth    int        `json:"queue_depth"`
+	QueueCapacity int        `json:"queue_capacity"`
+	Processed     int64      `json:"processed"`
+	LastRunAt     *time.Time `json:"last_run_at"`
 }
 
 // NewTaskWorker creates a new task worker
-func NewTaskWorker(db *database.DB, cfg *config.Config) *TaskWorker {
+func NewTaskWorker(tasks repositories.TaskRepository, cfg *config.Config, notifier *webhook.Notifier, hub *events.Hub) *TaskWorker {
 	return &TaskWorker{
-		db:             db,
-		cfg:            cfg,
-		taskChannel:    make(chan string, 100), // buffered channel
-		stopChannel:    make(chan struct{}),
-		processedTasks: make(map[string]bool),
+		tasks:       tasks,
+		cfg:         cfg,
+		taskChannel: make(chan string, 100), // buffered channel
+		stopChannel: make(chan struct{}),
+		notifier:    notifier,
+		hub:         hub,
+		interval:    workerInterval(cfg),
 	}
 }
 
 // Start starts the background worker
 func (w *TaskWorker) Start() {
-	log.Println("Starting task auto-completion worker...")
+	slog.Info("Starting task auto-completion worker")
 
-	// Start worker goroutine to process tasks from channel
+	// Start WORKER_CONCURRENCY goroutines to process manually submitted tasks
+	// from the channel. completeTask locks each task and only completes it
+	// if it is still open, so processors racing on the same ID complete it once.
+	for i := 0; i < w.cfg.WorkerConcurrency; i++ {
+		w.wg.Add(1)
+		go w.processTasksFromChannel()
+	}
+
+	// Start checker goroutine to periodically auto-complete due tasks in bulk
 	w.wg.Add(1)
-	go w.processTasksFromChannel()
+	go w.checkAndCompleteTasks()
 
-	// Start checker goroutine to periodically find and send tasks for auto-completion
+	// Start recurrence goroutine to create the next occurrence of completed recurring tasks
 	w.wg.Add(1)
-	go w.checkAndQueueTasks()
+	go w.checkRecurringTasks()
+
+	// Start purge goroutine to delete old completed tasks, if enabled
+	if w.cfg.PurgeEnabled {
+		w.wg.Add(1)
+		go w.checkPurge()
+	}
 
-	log.Println("Task worker started successfully")
+	slog.Info("Task worker started successfully", "processors", w.cfg.WorkerConcurrency)
 }
 
-// Stop stops the background worker gracefully
-func (w *TaskWorker) Stop() {
-	log.Println("Stopping task worker...")
+// Stop stops the background worker gracefully. It waits up to
+// WORKER_SHUTDOWN_SECONDS for in-flight work to finish and returns
+// ErrStopTimeout if a goroutine is still busy after that.
+func (w *TaskWorker) Stop() error {
+	slog.Info("Stopping task worker")
+
+	// Refuse new submissions before signalling the goroutines, so nothing
+	// is queued once they have started exiting
+	w.submitMu.Lock()
+	w.stopped = true
+	w.submitMu.Unlock()
 	close(w.stopChannel)
-	w.wg.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	timeout := time.Duration(w.cfg.WorkerShutdownSeconds) * time.Second
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		// A goroutine may still read from taskChannel, so leave it open
+		slog.Warn("Task worker did not stop in time", "timeout", timeout.String())
+		return ErrStopTimeout
+	}
+
+	w.submitMu.Lock()
 	close(w.taskChannel)
-	log.Println("Task worker stopped")
+	w.submitMu.Unlock()
+
+	slog.Info("Task worker stopped")
+	return nil
 }
 
-// checkAndQueueTasks periodically checks for tasks that should be auto-completed
-func (w *TaskWorker) checkAndQueueTasks() {
+// ErrStopTimeout is returned by Stop when in-flight work outlasts the
+// shutdown timeout
+var ErrStopTimeout = errors.New("timed out waiting for task worker to stop")
+
+// checkAndCompleteTasks periodically auto-completes tasks that are due
+func (w *TaskWorker) checkAndCompleteTasks() {
 	defer w.wg.Done()
 
-	// Check every minute
-	ticker := time.NewTicker(1 * time.Minute)
+	ticker := time.NewTicker(w.interval)
 	defer ticker.Stop()
 
 	for {
@@ -69,43 +150,66 @@ func (w *TaskWorker) checkAndQueueTasks() {
 		case <-w.stopChannel:
 			return
 		case <-ticker.C:
-			w.findAndQueueTasks()
+			w.completeDueTasks()
 		}
 	}
 }
 
-// findAndQueueTasks finds tasks that need auto-completion and sends them to the channel
-func (w *TaskWorker) findAndQueueTasks() {
-	tasks, err := repositories.GetTasksForAutoCompletion(w.db, w.cfg.AutoCompleteMinutes)
+// workerInterval returns how often to check for tasks to auto-complete.
+// Validate rejects a non-positive WORKER_INTERVAL_SECONDS; the fallback only
+// covers configs that skipped it.
+func workerInterval(cfg *config.Config) time.Duration {
+	if cfg.WorkerIntervalSeconds <= 0 {
+		slog.Warn("Invalid worker interval, using default", "interval_seconds", cfg.WorkerIntervalSeconds, "default", defaultInterval.String())
+		return defaultInterval
+	}
+	return time.Duration(cfg.WorkerIntervalSeconds) * time.Second
+}
+
+// completeDueTasks completes every due task with one statement, then sends
+// the usual notifications for each. Failures are retried on the next tick.
+func (w *TaskWorker) completeDueTasks() {
+	completed, err := w.tasks.AutoCompleteDueTasks(context.Background(), w.cfg.AutoCompleteMinutes)
 	if err != nil {
-		log.Printf("Error fetching tasks for auto-completion: %v\n", err)
+		metrics.WorkerAutoCompletionsTotal.WithLabelValues("failure").Inc()
+		slog.Error("Error auto-completing due tasks", "error", err)
 		return
 	}
 
-	for _, task := range tasks {
-		// Only process each task once
-		w.mu.Lock()
-		if _, exists := w.processedTasks[task.ID]; !exists {
-			w.processedTasks[task.ID] = true
-			w.mu.Unlock()
-
-			// Send task ID to channel (non-blocking with timeout)
-			select {
-			case w.taskChannel <- task.ID:
-				log.Printf("Queued task %s for auto-completion\n", task.ID)
-			case <-time.After(100 * time.Millisecond):
-				// Channel full, try again next time
-				w.mu.Lock()
-				delete(w.processedTasks, task.ID)
-				w.mu.Unlock()
-			}
-		} else {
-			w.mu.Unlock()
-		}
+	for _, c := range completed {
+		w.taskCompleted(c.Task, c.PreviousStatus)
 	}
+	metrics.WorkerAutoCompletionsTotal.WithLabelValues("success").Add(float64(len(completed)))
+
+	w.mu.Lock()
+	w.lastRunAt = time.Now().UTC()
+	w.mu.Unlock()
+
+	slog.Info("Auto-completion cycle finished", "completed", len(completed))
+}
+
+// taskCompleted records metrics and notifies webhook and stream subscribers
+// that the worker completed a task
+func (w *TaskWorker) taskCompleted(task *models.Task, previousStatus string) {
+	slog.Info("Task auto-completed", "task_id", task.ID, "user_id", task.UserID, "status", task.Status)
+	metrics.TasksCompletedTotal.WithLabelValues("worker").Inc()
+
+	w.mu.Lock()
+	w.processed++
+	w.mu.Unlock()
+
+	w.notifier.TaskCompleted(task, task.UserID, "worker")
+	w.hub.Publish(task.UserID, events.TaskEvent{
+		Type:           events.TypeTaskStatusChanged,
+		TaskID:         task.ID,
+		Status:         task.Status,
+		PreviousStatus: previousStatus,
+		Source:         "worker",
+		Timestamp:      task.UpdatedAt,
+	})
 }
 
-// processTasksFromChannel processes tasks from the channel
+// processTasksFromChannel processes manually submitted tasks from the channel
 func (w *TaskWorker) processTasksFromChannel() {
 	defer w.wg.Done()
 
@@ -119,41 +223,253 @@ func (w *TaskWorker) processTasksFromChannel() {
 	}
 }
 
-// autoCompleteTask marks a task as completed
+// autoCompleteTask marks a single submitted task as completed
 func (w *TaskWorker) autoCompleteTask(taskID string) {
 	// Verify the task still exists and is not already completed
-	task, err := repositories.GetTaskByID(w.db, taskID)
+	task, err := w.tasks.GetTaskByID(taskID)
 	if err != nil {
-		log.Printf("Task %s not found: %v\n", taskID, err)
+		slog.Warn("Task not found for auto-completion", "task_id", taskID, "error", err)
 		return
 	}
 
 	// Double-check status (in case it was manually completed)
-	if task.Status == "completed" {
-		log.Printf("Task %s is already completed, skipping auto-completion\n", taskID)
+	if task.Status == models.StatusCompleted || !models.CanTransition(models.ActorSystem, task.Status, models.StatusCompleted) {
+		slog.Info("Task cannot be auto-completed, skipping", "task_id", taskID, "status", task.Status)
 		return
 	}
+	if !task.AutoComplete {
+		slog.Info("Task has opted out of auto-completion, skipping", "task_id", taskID)
+		return
+	}
+
+	// Auto-complete the task, retrying transient errors with exponential backoff
+	backoff := initialBackoff
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		var completed bool
+		var previousStatus string
+		previousStatus, completed, err = w.completeTask(taskID)
+		if err == nil {
+			if completed {
+				metrics.WorkerAutoCompletionsTotal.WithLabelValues("success").Inc()
+				task.Status = models.StatusCompleted
+				task.Version++
+				task.UpdatedAt = time.Now().UTC()
+				w.taskCompleted(task, previousStatus)
+			}
+			return
+		}
+
+		slog.Error("Error auto-completing task", "task_id", taskID, "attempt", attempt, "max_attempts", maxAttempts, "error", err)
+		if attempt == maxAttempts {
+			break
+		}
+
+		select {
+		case <-w.stopChannel:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	// Give up; if the task is due, the next bulk check completes it
+	metrics.WorkerAutoCompletionsTotal.WithLabelValues("failure").Inc()
+}
+
+// completeTask auto-completes a task and records the change in its status
+// history in one transaction. It returns the status the task had before.
+func (w *TaskWorker) completeTask(taskID string) (string, bool, error) {
+	var previousStatus string
+	var completed bool
+
+	err := w.tasks.WithTx(context.Background(), func(tasks repositories.TaskRepository) error {
+		task, err := tasks.GetTaskByIDForUpdate(taskID)
+		if err != nil {
+			return err
+		}
+		previousStatus = task.Status
+
+		completed, err = tasks.AutoCompleteTask(taskID)
+		if err != nil || !completed {
+			return err
+		}
+		return tasks.RecordStatusChange(taskID, previousStatus, models.StatusCompleted, models.ChangedBySystem)
+	})
+	return previousStatus, completed, err
+}
+
+// checkRecurringTasks periodically creates the next occurrence of completed
+// recurring tasks
+func (w *TaskWorker) checkRecurringTasks() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopChannel:
+			return
+		case <-ticker.C:
+			w.recurDueTasks()
+		}
+	}
+}
 
-	// Auto-complete the task
-	if err := repositories.AutoCompleteTask(w.db, taskID); err != nil {
-		log.Printf("Error auto-completing task %s: %v\n", taskID, err)
+// recurDueTasks clones every recurring task whose next occurrence is due
+func (w *TaskWorker) recurDueTasks() {
+	tasks, err := w.tasks.GetRecurringTasksDue()
+	if err != nil {
+		slog.Error("Error fetching recurring tasks", "error", err)
 		return
 	}
 
-	log.Printf("Task %s auto-completed successfully\n", taskID)
+	for _, task := range tasks {
+		clone, err := w.recurTask(task.ID)
+		if err != nil {
+			slog.Error("Error creating next occurrence of recurring task", "task_id", task.ID, "error", err)
+			continue
+		}
+		if clone != nil {
+			metrics.TasksCreatedTotal.Inc()
+			slog.Info("Created next occurrence of recurring task", "task_id", task.ID, "new_task_id", clone.ID, "user_id", clone.UserID, "recurrence", clone.Recurrence)
+		}
+	}
+}
+
+// recurTask creates the next occurrence of a recurring task and clears the
+// original's next run, in one transaction with the original locked so the
+// occurrence is only created once. It returns nil if there was nothing to do.
+func (w *TaskWorker) recurTask(taskID string) (*models.Task, error) {
+	var clone *models.Task
+
+	err := w.tasks.WithTx(context.Background(), func(tasks repositories.TaskRepository) error {
+		task, err := tasks.GetTaskByIDForUpdate(taskID)
+		if err != nil {
+			return err
+		}
+
+		// Re-check under the lock: the task may have been reopened or already handled
+		if task.Status != models.StatusCompleted || task.Recurrence == models.RecurrenceNone || task.NextRunAt == nil {
+			return nil
+		}
+
+		// The new occurrence is due at the latest scheduled time that has
+		// passed, so a worker outage doesn't produce a backlog of copies
+		now := time.Now().UTC()
+		due := *task.NextRunAt
+		next := models.NextOccurrence(task.Recurrence, due)
+		for !next.After(now) {
+			due = next
+			next = models.NextOccurrence(task.Recurrence, due)
+		}
+
+		// CreateTask always inserts as pending, and the fresh created_at keeps
+		// the clone out of auto-completion for AUTO_COMPLETE_MINUTES
+		clone = &models.Task{
+			UserID:       task.UserID,
+			Title:        task.Title,
+			Description:  task.Description,
+			Status:       models.StatusPending,
+			Tags:         task.Tags,
+			DueDate:      &due,
+			Recurrence:   task.Recurrence,
+			NextRunAt:    &next,
+			AutoComplete: task.AutoComplete,
+		}
+		if err := tasks.CreateTask(clone); err != nil {
+			clone = nil
+			return err
+		}
+		return tasks.ClearTaskNextRun(task.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
+
+// checkPurge periodically deletes tasks completed more than
+// PURGE_COMPLETED_AFTER_DAYS ago
+func (w *TaskWorker) checkPurge() {
+	defer w.wg.Done()
+
+	// Cancel an in-progress purge between batches when the worker stops
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-w.stopChannel:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(time.Duration(w.cfg.PurgeIntervalHours) * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopChannel:
+			return
+		case <-ticker.C:
+			purged, err := w.tasks.PurgeCompletedTasks(ctx, w.cfg.PurgeCompletedAfterDays)
+			if err != nil && ctx.Err() == nil {
+				slog.Error("Error purging completed tasks", "purged", purged, "error", err)
+				continue
+			}
+			slog.Info("Purge cycle finished", "older_than_days", w.cfg.PurgeCompletedAfterDays, "purged", purged)
+		}
+	}
+}
+
+// Status reports the submission queue's depth and capacity, how many tasks
+// the worker has completed, and when the last auto-completion cycle
+// succeeded (nil if none has yet)
+func (w *TaskWorker) Status() Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := Status{
+		QueueDepth:    len(w.taskChannel),
+		QueueCapacity: cap(w.taskChannel),
+		Processed:     w.processed,
+	}
+	if !w.lastRunAt.IsZero() {
+		lastRunAt := w.lastRunAt
+		status.LastRunAt = &lastRunAt
+	}
+	return status
 }
 
-// SubmitTask allows external submission of tasks to be processed
-func (w *TaskWorker) SubmitTask(taskID string) error {
+// SubmitTask allows external submission of tasks to be processed. It waits
+// for room in the queue until ctx is done, and returns ErrChannelFull
+// (wrapping the context's error) if ctx timed out first, ctx.Err() if it
+// was cancelled, or ErrWorkerStopped once the worker is stopping.
+func (w *TaskWorker) SubmitTask(ctx context.Context, taskID string) error {
+	w.submitMu.RLock()
+	defer w.submitMu.RUnlock()
+
+	if w.stopped {
+		return ErrWorkerStopped
+	}
+
 	select {
 	case w.taskChannel <- taskID:
-		log.Printf("Manually submitted task %s for processing\n", taskID)
+		slog.Info("Manually submitted task for processing", "task_id", taskID)
 		return nil
-	case <-time.After(5 * time.Second):
-		return ErrChannelFull
+	case <-ctx.Done():
+		// A cancelled caller isn't a full queue
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w: %w", ErrChannelFull, ctx.Err())
 	}
 }
 
+// ErrWorkerStopped is returned when a task is submitted after Stop
+var ErrWorkerStopped = errors.New("worker stopped")
+
 // ErrChannelFull is returned when the task channel is full
 var ErrChannelFull = &ChannelFullError{}
 
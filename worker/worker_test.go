@@ -0,0 +1,244 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"taskapi/config"
+	"taskapi/models"
+	"taskapi/repositories"
+)
+
+const taskID = "44444444-4444-4444-4444-444444444444"
+
+var errTransient = errors.New("connection reset by peer")
+
+// fakeTaskRepo is an in-memory TaskRepository whose AutoCompleteTask fails
+// the first failures calls. Only the methods the worker tests exercise are
+// implemented; calling any other panics on the nil embedded interface.
+type fakeTaskRepo struct {
+	repositories.TaskRepository
+
+	mu       sync.Mutex
+	task     *models.Task
+	failures int
+	attempts int
+	history  int
+}
+
+func newFakeTaskRepo(failures int) *fakeTaskRepo {
+	return &fakeTaskRepo{
+		task:     &models.Task{ID: taskID, UserID: "11111111-1111-1111-1111-111111111111", Status: models.StatusPending, Version: 1, AutoComplete: true},
+		failures: failures,
+	}
+}
+
+func (r *fakeTaskRepo) GetTaskByID(id string) (*models.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id != r.task.ID {
+		return nil, repositories.ErrTaskNotFound
+	}
+	task := *r.task
+	return &task, nil
+}
+
+func (r *fakeTaskRepo) GetTaskByIDForUpdate(id string) (*models.Task, error) {
+	return r.GetTaskByID(id)
+}
+
+func (r *fakeTaskRepo) AutoCompleteTask(id string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts++
+	if r.attempts <= r.failures {
+		return false, errTransient
+	}
+	if r.task.Status == models.StatusCompleted {
+		return false, nil
+	}
+	r.task.Status = models.StatusCompleted
+	return true, nil
+}
+
+func (r *fakeTaskRepo) RecordStatusChange(taskID string, oldStatus string, newStatus string, changedBy string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.history++
+	return nil
+}
+
+// The fake has no transactions; fn runs against the repository itself
+func (r *fakeTaskRepo) WithTx(ctx context.Context, fn func(tasks repositories.TaskRepository) error) error {
+	return fn(r)
+}
+
+func testConfig() *config.Config {
+	return &config.Config{
+		AutoCompleteMinutes:   30,
+		WorkerIntervalSeconds: 60,
+		WorkerShutdownSeconds: 1,
+	}
+}
+
+func TestAutoCompleteTaskRetries(t *testing.T) {
+	tests := []struct {
+		name          string
+		failures      int
+		wantAttempts  int
+		wantCompleted bool
+	}{
+		{name: "succeeds first time", failures: 0, wantAttempts: 1, wantCompleted: true},
+		{name: "fails twice then succeeds", failures: 2, wantAttempts: 3, wantCompleted: true},
+		{name: "gives up after maxAttempts", failures: maxAttempts, wantAttempts: maxAttempts, wantCompleted: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeTaskRepo(tt.failures)
+			w := NewTaskWorker(repo, testConfig(), nil, nil)
+
+			w.autoCompleteTask(taskID)
+
+			if repo.attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", repo.attempts, tt.wantAttempts)
+			}
+			completed := repo.task.Status == models.StatusCompleted
+			if completed != tt.wantCompleted {
+				t.Errorf("completed = %v, want %v", completed, tt.wantCompleted)
+			}
+			wantProcessed, wantHistory := int64(0), 0
+			if tt.wantCompleted {
+				wantProcessed, wantHistory = 1, 1
+			}
+			if got := w.Status().Processed; got != wantProcessed {
+				t.Errorf("processed = %d, want %d", got, wantProcessed)
+			}
+			if repo.history != wantHistory {
+				t.Errorf("status history entries = %d, want %d", repo.history, wantHistory)
+			}
+		})
+	}
+}
+
+func TestAutoCompleteTaskStopsRetryingOnShutdown(t *testing.T) {
+	repo := newFakeTaskRepo(maxAttempts)
+	w := NewTaskWorker(repo, testConfig(), nil, nil)
+	close(w.stopChannel)
+
+	w.autoCompleteTask(taskID)
+
+	if repo.attempts != 1 {
+		t.Errorf("attempts = %d, want 1 once the worker is stopping", repo.attempts)
+	}
+}
+
+func TestAutoCompleteTaskSkipsOptedOut(t *testing.T) {
+	repo := newFakeTaskRepo(0)
+	repo.task.AutoComplete = false
+	w := NewTaskWorker(repo, testConfig(), nil, nil)
+
+	w.autoCompleteTask(taskID)
+
+	if repo.attempts != 0 {
+		t.Errorf("attempts = %d, want 0 for a task that opted out", repo.attempts)
+	}
+	if repo.task.Status != models.StatusPending {
+		t.Errorf("status = %q, want %q", repo.task.Status, models.StatusPending)
+	}
+}
+
+func TestSubmitTask(t *testing.T) {
+	w := NewTaskWorker(newFakeTaskRepo(0), testConfig(), nil, nil)
+
+	if err := w.SubmitTask(context.Background(), taskID); err != nil {
+		t.Fatalf("SubmitTask: %v", err)
+	}
+	if got := w.Status().QueueDepth; got != 1 {
+		t.Errorf("queue depth = %d, want 1", got)
+	}
+}
+
+func TestSubmitTaskAfterStop(t *testing.T) {
+	w := NewTaskWorker(newFakeTaskRepo(0), testConfig(), nil, nil)
+	w.Start()
+	if err := w.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	// Sending on the closed channel would panic rather than return
+	if err := w.SubmitTask(context.Background(), taskID); !errors.Is(err, ErrWorkerStopped) {
+		t.Fatalf("err = %v, want %v", err, ErrWorkerStopped)
+	}
+}
+
+// TestSubmitTaskDuringStop submits while the worker stops; run with -race
+func TestSubmitTaskDuringStop(t *testing.T) {
+	w := NewTaskWorker(newFakeTaskRepo(0), testConfig(), nil, nil)
+	w.Start()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := w.SubmitTask(context.Background(), taskID); err != nil && !errors.Is(err, ErrWorkerStopped) {
+				t.Errorf("SubmitTask: %v", err)
+			}
+		}()
+	}
+	if err := w.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	wg.Wait()
+
+	if err := w.SubmitTask(context.Background(), taskID); !errors.Is(err, ErrWorkerStopped) {
+		t.Fatalf("err = %v, want %v", err, ErrWorkerStopped)
+	}
+}
+
+func TestSubmitTaskFullQueue(t *testing.T) {
+	tests := []struct {
+		name        string
+		ctx         func() (context.Context, context.CancelFunc)
+		wantErr     error
+		wantFullErr bool
+	}{
+		{
+			name:    "cancelled context",
+			ctx:     func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) },
+			wantErr: context.Canceled,
+		},
+		{
+			name:        "timed out waiting for room",
+			ctx:         func() (context.Context, context.CancelFunc) { return context.WithTimeout(context.Background(), 0) },
+			wantErr:     context.DeadlineExceeded,
+			wantFullErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewTaskWorker(newFakeTaskRepo(0), testConfig(), nil, nil)
+
+			// Nothing reads the queue until Start, so fill it
+			for i := 0; i < cap(w.taskChannel); i++ {
+				if err := w.SubmitTask(context.Background(), taskID); err != nil {
+					t.Fatalf("SubmitTask %d: %v", i, err)
+				}
+			}
+
+			ctx, cancel := tt.ctx()
+			cancel()
+			err := w.SubmitTask(ctx, taskID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if isFull := errors.Is(err, ErrChannelFull); isFull != tt.wantFullErr {
+				t.Errorf("err = %v, reported as a full queue = %v, want %v", err, isFull, tt.wantFullErr)
+			}
+		})
+	}
+}